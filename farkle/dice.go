@@ -0,0 +1,121 @@
+package farkle
+
+import (
+	crand "crypto/rand"
+	"fmt"
+	"math/rand/v2"
+)
+
+// MARK: Dice sources
+
+// DiceSource produces the faces for every roll in a game.
+type DiceSource interface {
+	Roll(n int) []int
+}
+
+// SeededDice is a reproducible PRNG source; the same seed replays the same game.
+type SeededDice struct {
+	Seed uint64
+	pcg  *rand.PCG
+	rng  *rand.Rand
+}
+
+func NewSeededDice(seed uint64) *SeededDice {
+	pcg := rand.NewPCG(seed, seed^0x9e3779b97f4a7c15)
+	return &SeededDice{Seed: seed, pcg: pcg, rng: rand.New(pcg)}
+}
+
+// RandomSeed picks a fresh seed for a SeededDice.
+func RandomSeed() uint64 {
+	return rand.Uint64()
+}
+
+func (s *SeededDice) Roll(n int) []int {
+	dice := make([]int, n)
+	for i := range dice {
+		dice[i] = s.rng.IntN(6) + 1
+	}
+	return dice
+}
+
+// CryptoDice draws every face from crypto/rand; used for networked play.
+type CryptoDice struct{}
+
+func (CryptoDice) Roll(n int) []int {
+	dice := make([]int, 0, n)
+	buf := make([]byte, 1)
+	for len(dice) < n {
+		if _, err := crand.Read(buf); err != nil {
+			panic("farkle: crypto/rand unavailable: " + err.Error())
+		}
+		// 252 is the largest multiple of 6 below 256; reject to stay unbiased.
+		if buf[0] < 252 {
+			dice = append(dice, int(buf[0]%6)+1)
+		}
+	}
+	return dice
+}
+
+// ScriptedDice replays Faces in order, wrapping around when exhausted.
+type ScriptedDice struct {
+	Faces []int
+	Pos   int
+}
+
+func (s *ScriptedDice) Roll(n int) []int {
+	dice := make([]int, n)
+	for i := range dice {
+		dice[i] = s.Faces[s.Pos%len(s.Faces)]
+		s.Pos++
+	}
+	return dice
+}
+
+// MARK: Dice state
+
+// DiceState is a serialisable snapshot of a DiceSource, so a saved game
+// resumes with exactly the rolls it would have made.
+type DiceState struct {
+	Kind  string `json:"kind"` // "seeded", "crypto" or "scripted"
+	Seed  uint64 `json:"seed,omitempty"`
+	PCG   []byte `json:"pcg,omitempty"`
+	Faces []int  `json:"faces,omitempty"`
+	Pos   int    `json:"pos,omitempty"`
+}
+
+// SnapshotDice captures the state of one of the built-in dice sources.
+func SnapshotDice(d DiceSource) (DiceState, error) {
+	switch d := d.(type) {
+	case *SeededDice:
+		pcg, err := d.pcg.MarshalBinary()
+		if err != nil {
+			return DiceState{}, err
+		}
+		return DiceState{Kind: "seeded", Seed: d.Seed, PCG: pcg}, nil
+	case CryptoDice:
+		return DiceState{Kind: "crypto"}, nil
+	case *ScriptedDice:
+		return DiceState{Kind: "scripted", Faces: d.Faces, Pos: d.Pos}, nil
+	}
+	return DiceState{}, fmt.Errorf("dice source %T cannot be saved", d)
+}
+
+// Restore rebuilds the dice source captured by SnapshotDice.
+func (s DiceState) Restore() (DiceSource, error) {
+	switch s.Kind {
+	case "seeded":
+		d := NewSeededDice(s.Seed)
+		if err := d.pcg.UnmarshalBinary(s.PCG); err != nil {
+			return nil, fmt.Errorf("restoring dice: %w", err)
+		}
+		return d, nil
+	case "crypto":
+		return CryptoDice{}, nil
+	case "scripted":
+		if len(s.Faces) == 0 {
+			return nil, fmt.Errorf("restoring dice: empty script")
+		}
+		return &ScriptedDice{Faces: s.Faces, Pos: s.Pos}, nil
+	}
+	return nil, fmt.Errorf("restoring dice: unknown kind %q", s.Kind)
+}
@@ -0,0 +1,195 @@
+package farkle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// MARK: LAN discovery
+
+// A client looking for lobbies sends a "discover" datagram to the local
+// network on discoveryPort: IPv4 broadcast on every interface and IPv6
+// all-nodes multicast. Every host that listed its lobby (--lan) answers
+// senders on its own subnets with a LobbyInfo. The answer leaves out the
+// lobby secret: a joiner pairs with the host instead (see secure.go), and
+// the host admits them by the code on their screen. Watching a game already
+// under way still takes the lobby ID, checked against the fingerprint the
+// answer carries.
+const discoveryPort = 9314
+
+// LobbyInfo is a host's answer to a discovery query.
+type LobbyInfo struct {
+	T           string `json:"t"` // "lobby_info"
+	Version     int    `json:"v"`
+	Fingerprint string `json:"fp"`   // lobbyFingerprint of the secret
+	Port        int    `json:"port"` // TCP port the lobby listens on
+	Name        string `json:"name"`
+	Target      int    `json:"target"`
+	Rules       string `json:"rules"`
+	Open        int    `json:"open"`  // free seats
+	Seats       int    `json:"seats"` // remote seats in all
+	Started     bool   `json:"started,omitempty"`
+	Addr        string `json:"-"` // where the answer came from; dial this
+}
+
+// lobbyFingerprint names a lobby on the local network without giving away
+// its secret.
+func lobbyFingerprint(secret []byte) string {
+	sum := sha256.Sum256(append([]byte("farkle fingerprint"), secret...))
+	fp := strings.ToUpper(hex.EncodeToString(sum[:4]))
+	return fp[:4] + "-" + fp[4:]
+}
+
+// Check reports whether id is the lobby ID of this lobby.
+func (info LobbyInfo) Check(id string) error {
+	_, _, secret, err := decodeLobbyID(id)
+	if err != nil {
+		return err
+	}
+	if fp := lobbyFingerprint(secret); fp != info.Fingerprint {
+		return fmt.Errorf("that is the ID of another lobby (fingerprint %s, not %s)", fp, info.Fingerprint)
+	}
+	return nil
+}
+
+// advertise answers discovery queries for the lobby until stop is closed.
+// Queries from outside the local subnets get no answer, so the responder
+// cannot be used to reflect traffic at hosts elsewhere.
+func (l *lobby) advertise(port int, stop <-chan struct{}) {
+	pc, err := net.ListenPacket("udp", fmt.Sprintf(":%d", discoveryPort))
+	if err != nil {
+		fmt.Println(ColorYellow + "Cannot list the lobby on the local network: " + err.Error() + ColorReset)
+		return
+	}
+	go func() {
+		<-stop
+		pc.Close()
+	}()
+	fmt.Println(ColorCyan + "Listed on the local network as " + lobbyFingerprint(l.secret) + " – players nearby find it with 'lobbies', and you admit each one by the code on their screen." + ColorReset)
+	buf := make([]byte, 512)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if ua, ok := from.(*net.UDPAddr); !ok || !onLocalSubnet(ua.IP) {
+			continue
+		}
+		var q NetMsg
+		if json.Unmarshal(buf[:n], &q) != nil || q.T != "discover" {
+			continue
+		}
+		data, _ := json.Marshal(l.info(port))
+		pc.WriteTo(data, from)
+	}
+}
+
+// onLocalSubnet reports whether ip is on the same subnet as one of this
+// machine's interfaces, loopback included.
+func onLocalSubnet(ip net.IP) bool {
+	addrs, _ := net.InterfaceAddrs()
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// info describes the lobby for discovery.
+func (l *lobby) info(port int) LobbyInfo {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	rules := ClassicRules.Name
+	if l.welcome.Rules != nil {
+		rules = l.welcome.Rules.Name
+	}
+	info := LobbyInfo{T: "lobby_info", Version: protocolVersion, Fingerprint: lobbyFingerprint(l.secret), Port: port, Name: l.name, Target: l.welcome.Target, Rules: rules, Open: l.open, Seats: maxRemotes, Started: l.started}
+	if l.started {
+		info.Open = 0
+	}
+	return info
+}
+
+// FindLobbies asks the local network for listed lobbies and collects the
+// answers that arrive within wait, one per lobby, in order of arrival.
+func FindLobbies(wait time.Duration) ([]LobbyInfo, error) {
+	pc, err := net.ListenPacket("udp", ":0")
+	if err != nil {
+		return nil, err
+	}
+	defer pc.Close()
+	query, _ := json.Marshal(NetMsg{T: "discover", Version: protocolVersion})
+	sent := 0
+	for _, dst := range discoveryTargets() {
+		if _, err := pc.WriteTo(query, dst); err == nil {
+			sent++
+		}
+	}
+	if sent == 0 {
+		return nil, fmt.Errorf("no network interface could send a discovery query")
+	}
+
+	var found []LobbyInfo
+	seen := map[string]bool{}
+	buf := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(wait))
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if err != nil {
+			break // deadline reached
+		}
+		var info LobbyInfo
+		if json.Unmarshal(buf[:n], &info) != nil || info.T != "lobby_info" || info.Version != protocolVersion || seen[info.Fingerprint] {
+			continue
+		}
+		seen[info.Fingerprint] = true
+		ua := from.(*net.UDPAddr)
+		info.Addr = ua.IP.String()
+		if ua.Zone != "" {
+			info.Addr += "%" + ua.Zone
+		}
+		found = append(found, info)
+	}
+	return found, nil
+}
+
+// discoveryTargets lists where to send a query: the broadcast address of
+// every IPv4 network, IPv6 all-nodes on every multicast interface, and the
+// loopback address for a host on this machine.
+func discoveryTargets() []*net.UDPAddr {
+	targets := []*net.UDPAddr{
+		{IP: net.IPv4bcast, Port: discoveryPort},
+		{IP: net.IPv4(127, 0, 0, 1), Port: discoveryPort},
+	}
+	ifaces, _ := net.Interfaces()
+	for _, ifc := range ifaces {
+		if ifc.Flags&net.FlagUp == 0 || ifc.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		if ifc.Flags&net.FlagMulticast != 0 {
+			targets = append(targets, &net.UDPAddr{IP: net.IPv6linklocalallnodes, Port: discoveryPort, Zone: ifc.Name})
+		}
+		if ifc.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+		addrs, _ := ifc.Addrs()
+		for _, a := range addrs {
+			ipnet, ok := a.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil || len(ipnet.Mask) != net.IPv4len {
+				continue
+			}
+			bcast := make(net.IP, net.IPv4len)
+			for i := range bcast {
+				bcast[i] = ipnet.IP.To4()[i] | ^ipnet.Mask[i]
+			}
+			targets = append(targets, &net.UDPAddr{IP: bcast, Port: discoveryPort})
+		}
+	}
+	return targets
+}
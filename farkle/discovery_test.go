@@ -0,0 +1,39 @@
+package farkle
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestLobbyInfoCheck(t *testing.T) {
+	secret, other := newLobbySecret(), newLobbySecret()
+	info := LobbyInfo{Fingerprint: lobbyFingerprint(secret)}
+	id, _ := encodeLobbyID("192.0.2.7", 9313, secret)
+	otherID, _ := encodeLobbyID("192.0.2.7", 9313, other)
+
+	if err := info.Check(id); err != nil {
+		t.Errorf("own ID: %v", err)
+	}
+	if err := info.Check(otherID); err == nil || !strings.Contains(err.Error(), "another lobby") {
+		t.Errorf("another lobby's ID: err = %v", err)
+	}
+	if err := info.Check(id[:len(id)-1]); err == nil {
+		t.Error("truncated ID accepted")
+	}
+}
+
+func TestOnLocalSubnet(t *testing.T) {
+	for _, tt := range []struct {
+		ip   string
+		want bool
+	}{
+		{"127.0.0.1", true},
+		{"203.0.113.9", false}, // TEST-NET-3, never assigned to an interface here
+		{"2001:db8::9", false},
+	} {
+		if got := onLocalSubnet(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("onLocalSubnet(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
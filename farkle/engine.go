@@ -0,0 +1,388 @@
+package farkle
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MARK: Engine errors
+var (
+	ErrGameOver      = errors.New("the game is over")
+	ErrMustRoll      = errors.New("roll the dice first")
+	ErrMustKeep      = errors.New("keep scoring dice from the current roll first")
+	ErrNothingToBank = errors.New("nothing to bank this turn")
+)
+
+// OpeningError is returned by Bank when a player who is not yet on the
+// board has not reached the opening score.
+type OpeningError struct {
+	Need, Have int
+}
+
+func (e *OpeningError) Error() string {
+	return fmt.Sprintf("you need %d to get on the board (turn total %d); keep rolling", e.Need, e.Have)
+}
+
+// MARK: Events
+
+// EventType values mirror the NetMsg "t" field where a network message exists.
+type EventType string
+
+const (
+	EvTurn       EventType = "turn"
+	EvRoll       EventType = "roll"
+	EvKeep       EventType = "keep"
+	EvHot        EventType = "hot"
+	EvFarkle     EventType = "farkle"
+	EvBank       EventType = "bank"
+	EvPenalty    EventType = "penalty"
+	EvLastChance EventType = "last_chance"
+	EvGameOver   EventType = "game_over"
+	EvForfeit    EventType = "forfeit"
+)
+
+// Event describes one state change produced by a Game transition.
+type Event struct {
+	Type  EventType
+	Idx   int   // player the event belongs to
+	Dice  []int // rolled or kept dice
+	Delta int   // points gained by this event
+	Turn  int   // unbanked turn score after the event
+	Total int   // player's banked total after the event
+	Round int
+}
+
+// MARK: Game state
+
+// TurnState is the in-progress turn of the current player.
+type TurnState struct {
+	Idx      int   // whose turn it is
+	Score    int   // unbanked points
+	DiceLeft int   // dice available for the next roll
+	Roll     []int // roll awaiting a keep; nil when the dice must be rolled
+}
+
+// Options configure a match. Every game mode takes one.
+type Options struct {
+	Target        int
+	Rules         *ScoringRules
+	Dice          DiceSource
+	OpeningScore  int  // minimum first bank to get on the board; 0 disables
+	FarklePenalty int  // points lost on a third farkle in a row; 0 disables
+	FinalRound    bool // everyone else gets one more turn once the target is reached
+	Recorder      Recorder
+}
+
+// Recorder, when set in Options, sees every event a Game produces, in order.
+type Recorder interface {
+	Record(g *Game, events []Event)
+}
+
+// farklesForPenalty is the streak length that triggers FarklePenalty.
+const farklesForPenalty = 3
+
+// Game is an I/O-free Farkle match. Drive it with Roll, Keep and Bank and
+// render the returned events however the mode needs to.
+type Game struct {
+	Options
+	Players []Player
+	Round   int
+	Turn    TurnState
+	Over    bool
+	Winner  int
+
+	LastChance bool // final round in progress
+	Closer     int  // player whose bank started the final round
+}
+
+// Standing is one player's place in the final results.
+type Standing struct {
+	Idx   int    `json:"idx"`
+	Name  string `json:"name"`
+	Total int    `json:"total"`
+}
+
+// NewGame starts a match with the first player to act. Missing options fall
+// back to a 1000-point target, ClassicRules and randomly seeded dice.
+func NewGame(opts Options, players ...Player) *Game {
+	if opts.Target <= 0 {
+		opts.Target = 1000
+	}
+	if opts.Rules == nil {
+		opts.Rules = ClassicRules
+	}
+	if opts.Dice == nil {
+		opts.Dice = NewSeededDice(RandomSeed())
+	}
+	return &Game{
+		Options: opts,
+		Players: players,
+		Round:   1,
+		Turn:    TurnState{DiceLeft: 6},
+	}
+}
+
+// OnBoard reports whether player i may bank any amount.
+func (g *Game) OnBoard(i int) bool {
+	return g.OpeningScore <= 0 || g.Players[i].OnBoard
+}
+
+// Current returns the player whose turn it is.
+func (g *Game) Current() *Player {
+	return &g.Players[g.Turn.Idx]
+}
+
+// Roll throws the remaining dice. A roll without any scoring dice farkles
+// and passes the turn.
+func (g *Game) Roll() ([]Event, error) {
+	if g.Over {
+		return nil, ErrGameOver
+	}
+	if g.Turn.Roll != nil {
+		return nil, ErrMustKeep
+	}
+	t := &g.Turn
+	roll := g.Dice.Roll(t.DiceLeft)
+	events := []Event{g.event(EvRoll, roll, 0)}
+	if g.Rules.Score(roll) == 0 {
+		events = append(events, g.farkle(roll)...)
+		return g.record(append(events, g.nextTurn()...)), nil
+	}
+	t.Roll = roll
+	return g.record(events), nil
+}
+
+// Keep scores dice from the current roll and continues the turn.
+func (g *Game) Keep(dice []int) ([]Event, error) {
+	if g.Over {
+		return nil, ErrGameOver
+	}
+	if g.Turn.Roll == nil {
+		return nil, ErrMustRoll
+	}
+	if err := g.Rules.ValidateKeep(g.Turn.Roll, dice); err != nil {
+		return nil, err
+	}
+	return g.record(g.keep(dice)), nil
+}
+
+func (g *Game) keep(dice []int) []Event {
+	t := &g.Turn
+	points := g.Rules.Score(dice)
+	t.Score += points
+	t.DiceLeft -= len(dice)
+	t.Roll = nil
+	events := []Event{g.event(EvKeep, dice, points)}
+	if t.DiceLeft == 0 {
+		t.DiceLeft = 6
+		events = append(events, g.event(EvHot, nil, 0))
+	}
+	return events
+}
+
+// Bank scores dice from the current roll (if any) and adds the turn score
+// to the player's total. With no roll pending, dice may be nil.
+func (g *Game) Bank(dice []int) ([]Event, error) {
+	if g.Over {
+		return nil, ErrGameOver
+	}
+	t := &g.Turn
+	pending := t.Score
+	if t.Roll != nil {
+		if len(dice) == 0 {
+			return nil, ErrMustKeep
+		}
+		if err := g.Rules.ValidateKeep(t.Roll, dice); err != nil {
+			return nil, err
+		}
+		pending += g.Rules.Score(dice)
+	} else if len(dice) > 0 {
+		return nil, ErrMustRoll
+	}
+	if pending == 0 {
+		return nil, ErrNothingToBank
+	}
+	if !g.OnBoard(t.Idx) && pending < g.OpeningScore {
+		return nil, &OpeningError{Need: g.OpeningScore, Have: pending}
+	}
+
+	var events []Event
+	if t.Roll != nil {
+		events = g.keep(dice)
+	}
+	p := g.Current()
+	banked := t.Score
+	p.Total += banked
+	p.OnBoard = true
+	p.FarkleStreak = 0
+	events = append(events, g.event(EvBank, nil, banked))
+	if p.Total >= g.Target && !g.LastChance {
+		if !g.FinalRound {
+			return g.record(append(events, g.finish())), nil
+		}
+		g.LastChance = true
+		g.Closer = t.Idx
+		events = append(events, g.event(EvLastChance, nil, 0))
+	}
+	return g.record(append(events, g.nextTurn()...)), nil
+}
+
+// Standings lists the players from highest to lowest total, forfeited
+// players last. Ties keep the player who started the final round (or turn
+// order) ahead.
+func (g *Game) Standings() []Standing {
+	out := make([]Standing, 0, len(g.Players))
+	first := 0
+	if g.LastChance {
+		first = g.Closer
+	}
+	for k := range g.Players {
+		i := (first + k) % len(g.Players)
+		out = append(out, Standing{Idx: i, Name: g.Players[i].Name, Total: g.Players[i].Total})
+	}
+	sort.SliceStable(out, func(a, b int) bool {
+		if outA, outB := g.Players[out[a].Idx].Out, g.Players[out[b].Idx].Out; outA != outB {
+			return outB
+		}
+		return out[a].Total > out[b].Total
+	})
+	return out
+}
+
+func (g *Game) finish() Event {
+	g.Over = true
+	g.Winner = g.Standings()[0].Idx
+	return Event{Type: EvGameOver, Idx: g.Winner, Total: g.Players[g.Winner].Total, Round: g.Round}
+}
+
+// Bust ends the current turn without banking, exactly like a farkle.
+func (g *Game) Bust() []Event {
+	if g.Over {
+		return nil
+	}
+	events := g.farkle(g.Turn.Roll)
+	return g.record(append(events, g.nextTurn()...))
+}
+
+// Forfeit takes player i out of the game: their turns are skipped and they
+// cannot win. A forfeit during their own turn ends it; once a single player
+// remains, the game is over.
+func (g *Game) Forfeit(i int) []Event {
+	if g.Over || g.Players[i].Out {
+		return nil
+	}
+	g.Players[i].Out = true
+	ev := g.event(EvForfeit, nil, 0)
+	ev.Idx, ev.Total = i, g.Players[i].Total
+	events := []Event{ev}
+	left := 0
+	for _, p := range g.Players {
+		if !p.Out {
+			left++
+		}
+	}
+	switch {
+	case left < 2:
+		events = append(events, g.finish())
+	case i == g.Turn.Idx:
+		g.Turn.Score = 0
+		events = append(events, g.nextTurn()...)
+	}
+	return g.record(events)
+}
+
+// farkle wipes the turn score and applies the three-farkle penalty.
+func (g *Game) farkle(roll []int) []Event {
+	g.Turn.Score = 0
+	p := g.Current()
+	p.FarkleStreak++
+	events := []Event{g.event(EvFarkle, roll, 0)}
+	if g.FarklePenalty > 0 && p.FarkleStreak >= farklesForPenalty {
+		p.Total -= g.FarklePenalty
+		p.FarkleStreak = 0
+		events = append(events, g.event(EvPenalty, nil, -g.FarklePenalty))
+	}
+	return events
+}
+
+func (g *Game) nextTurn() []Event {
+	next := g.Turn.Idx
+	for {
+		next = (next + 1) % len(g.Players)
+		if g.LastChance && next == g.Closer {
+			return []Event{g.finish()}
+		}
+		if next == 0 {
+			g.Round++
+		}
+		if !g.Players[next].Out {
+			break
+		}
+	}
+	g.Turn = TurnState{Idx: next, DiceLeft: 6}
+	return []Event{g.event(EvTurn, nil, 0)}
+}
+
+// record hands events to the Recorder, if any, and returns them.
+func (g *Game) record(events []Event) []Event {
+	if g.Recorder != nil {
+		g.Recorder.Record(g, events)
+	}
+	return events
+}
+
+func (g *Game) event(typ EventType, dice []int, delta int) Event {
+	return Event{
+		Type:  typ,
+		Idx:   g.Turn.Idx,
+		Dice:  dice,
+		Delta: delta,
+		Turn:  g.Turn.Score,
+		Total: g.Players[g.Turn.Idx].Total,
+		Round: g.Round,
+	}
+}
+
+// MARK: Keep validation
+
+// DeadDiceError reports kept dice that do not contribute to any combination.
+type DeadDiceError struct {
+	Dice []int
+}
+
+func (e *DeadDiceError) Error() string {
+	if len(e.Dice) == 1 {
+		return fmt.Sprintf("die %d does not score; keep only scoring dice", e.Dice[0])
+	}
+	return fmt.Sprintf("dice %s do not score; keep only scoring dice", strings.Trim(fmt.Sprint(e.Dice), "[]"))
+}
+
+// ValidateKeep reports why dice cannot be kept from roll, or nil if they
+// can. Every kept die must be part of a scoring combination.
+func (r *ScoringRules) ValidateKeep(roll, dice []int) error {
+	if len(dice) == 0 {
+		return errors.New("no dice selected")
+	}
+	avail := make(map[int]int)
+	for _, d := range roll {
+		avail[d]++
+	}
+	req := make(map[int]int)
+	for _, d := range dice {
+		if d < 1 || d > 6 {
+			return fmt.Errorf("invalid die value: %d", d)
+		}
+		req[d]++
+	}
+	for val := 1; val <= 6; val++ {
+		if cnt := req[val]; cnt > avail[val] {
+			return fmt.Errorf("cannot keep %d of '%d'; only %d available", cnt, val, avail[val])
+		}
+	}
+	if dead := r.Dead(dice); len(dead) > 0 {
+		return &DeadDiceError{Dice: dead}
+	}
+	return nil
+}
@@ -0,0 +1,386 @@
+package farkle
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// Rolls the engine tests script, six dice at a time.
+var (
+	farkleRoll = []int{2, 3, 4, 6, 2, 3} // nothing scores
+	oneRoll    = []int{1, 2, 3, 4, 6, 6} // only the 1 scores: 100
+	hotRoll    = []int{1, 1, 1, 5, 5, 5} // everything scores: 1500
+)
+
+// engineStep is one call on the Game and what it should produce.
+type engineStep struct {
+	do   string // "roll", "keep", "bank" or "forfeit"
+	dice []int  // for keep and bank
+	who  int    // for forfeit
+	err  error  // nil for success
+	ev   []EventType
+}
+
+// rolls joins scripted rolls into one ScriptedDice script.
+func rolls(rs ...[]int) []int {
+	return slices.Concat(rs...)
+}
+
+// sameError matches sentinels with errors.Is and the engine's error types
+// by value.
+func sameError(got, want error) bool {
+	switch w := want.(type) {
+	case *DeadDiceError:
+		var d *DeadDiceError
+		return errors.As(got, &d) && slices.Equal(d.Dice, w.Dice)
+	case *OpeningError:
+		var o *OpeningError
+		return errors.As(got, &o) && *o == *w
+	}
+	return errors.Is(got, want)
+}
+
+// types lists the type of every event, in order.
+func types(events []Event) []EventType {
+	var out []EventType
+	for _, e := range events {
+		out = append(out, e.Type)
+	}
+	return out
+}
+
+func TestEngine(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		opts    Options
+		players int
+		faces   []int
+		steps   []engineStep
+		check   func(t *testing.T, g *Game)
+	}{
+		{
+			name: "turn order errors", players: 2, faces: oneRoll,
+			steps: []engineStep{
+				{do: "keep", dice: []int{1}, err: ErrMustRoll},
+				{do: "bank", err: ErrNothingToBank},
+				{do: "roll", ev: []EventType{EvRoll}},
+				{do: "roll", err: ErrMustKeep},
+				{do: "bank", err: ErrMustKeep},
+				{do: "keep", dice: []int{1}, ev: []EventType{EvKeep}},
+				{do: "bank", dice: []int{5}, err: ErrMustRoll},
+				{do: "bank", ev: []EventType{EvBank, EvTurn}},
+			},
+			check: func(t *testing.T, g *Game) {
+				if g.Players[0].Total != 100 || g.Turn.Idx != 1 {
+					t.Errorf("player 0 total %d, turn %d; want 100 and player 1", g.Players[0].Total, g.Turn.Idx)
+				}
+			},
+		},
+		{
+			name: "dead dice", players: 2, faces: oneRoll,
+			steps: []engineStep{
+				{do: "roll"},
+				{do: "keep", dice: []int{1, 2}, err: &DeadDiceError{Dice: []int{2}}},
+				{do: "keep", dice: []int{2, 3, 6}, err: &DeadDiceError{Dice: []int{2, 3, 6}}},
+				{do: "bank", dice: []int{1, 6}, err: &DeadDiceError{Dice: []int{6}}},
+				{do: "keep", dice: []int{1}},
+			},
+			check: func(t *testing.T, g *Game) {
+				if g.Turn.Score != 100 || g.Turn.DiceLeft != 5 {
+					t.Errorf("turn %d with %d dice left; want 100 with 5", g.Turn.Score, g.Turn.DiceLeft)
+				}
+			},
+		},
+		{
+			name: "hot dice", players: 2, faces: rolls(hotRoll, oneRoll),
+			steps: []engineStep{
+				{do: "roll"},
+				{do: "keep", dice: hotRoll, ev: []EventType{EvKeep, EvHot}},
+				{do: "roll", ev: []EventType{EvRoll}},
+				{do: "bank", dice: []int{1}, ev: []EventType{EvKeep, EvBank, EvGameOver}},
+			},
+			check: func(t *testing.T, g *Game) {
+				if g.Players[0].Total != 1600 || !g.Over || g.Winner != 0 {
+					t.Errorf("total %d, over %v, winner %d; want 1600, true, 0", g.Players[0].Total, g.Over, g.Winner)
+				}
+			},
+		},
+		{
+			name: "opening score", players: 2, faces: rolls(oneRoll, farkleRoll[:5], hotRoll, oneRoll),
+			opts: Options{OpeningScore: 500, Target: 10000},
+			steps: []engineStep{
+				{do: "roll"},
+				{do: "bank", dice: []int{1}, err: &OpeningError{Need: 500, Have: 100}},
+				{do: "keep", dice: []int{1}},
+				{do: "bank", err: &OpeningError{Need: 500, Have: 100}},
+				{do: "roll", ev: []EventType{EvRoll, EvFarkle, EvTurn}},
+				{do: "roll"},
+				{do: "bank", dice: hotRoll, ev: []EventType{EvKeep, EvHot, EvBank, EvTurn}},
+				{do: "roll"},
+				{do: "bank", dice: []int{1}, err: &OpeningError{Need: 500, Have: 100}},
+			},
+			check: func(t *testing.T, g *Game) {
+				if g.Players[0].Total != 0 || g.Players[0].OnBoard || g.Players[1].Total != 1500 || !g.Players[1].OnBoard {
+					t.Errorf("players %+v; want only player 1 on the board with 1500", g.Players)
+				}
+			},
+		},
+		{
+			name: "opening score once on the board", players: 1, faces: rolls(hotRoll, oneRoll),
+			opts: Options{OpeningScore: 500, Target: 10000},
+			steps: []engineStep{
+				{do: "roll"},
+				{do: "bank", dice: hotRoll},
+				{do: "roll"},
+				{do: "bank", dice: []int{1}, ev: []EventType{EvKeep, EvBank, EvTurn}},
+			},
+			check: func(t *testing.T, g *Game) {
+				if g.Players[0].Total != 1600 {
+					t.Errorf("total %d, want 1600", g.Players[0].Total)
+				}
+			},
+		},
+		{
+			name: "third farkle penalty", players: 2, faces: farkleRoll,
+			opts: Options{FarklePenalty: 500},
+			steps: []engineStep{
+				{do: "roll", ev: []EventType{EvRoll, EvFarkle, EvTurn}},
+				{do: "roll"},
+				{do: "roll"},
+				{do: "roll"},
+				{do: "roll", ev: []EventType{EvRoll, EvFarkle, EvPenalty, EvTurn}},
+			},
+			check: func(t *testing.T, g *Game) {
+				if p := g.Players[0]; p.Total != -500 || p.FarkleStreak != 0 {
+					t.Errorf("player 0 total %d streak %d; want -500 and a fresh streak", p.Total, p.FarkleStreak)
+				}
+				if p := g.Players[1]; p.Total != 0 || p.FarkleStreak != 2 {
+					t.Errorf("player 1 total %d streak %d; want 0 and 2", p.Total, p.FarkleStreak)
+				}
+			},
+		},
+		{
+			name: "banking resets the farkle streak", players: 2,
+			faces: rolls(farkleRoll, farkleRoll, farkleRoll, farkleRoll, oneRoll, farkleRoll, farkleRoll),
+			opts:  Options{FarklePenalty: 500},
+			steps: []engineStep{
+				{do: "roll"},
+				{do: "roll"},
+				{do: "roll"},
+				{do: "roll"},
+				{do: "roll"},
+				{do: "bank", dice: []int{1}},
+				{do: "roll", ev: []EventType{EvRoll, EvFarkle, EvPenalty, EvTurn}},
+				{do: "roll", ev: []EventType{EvRoll, EvFarkle, EvTurn}},
+			},
+			check: func(t *testing.T, g *Game) {
+				if p := g.Players[0]; p.Total != 100 || p.FarkleStreak != 1 {
+					t.Errorf("player 0 total %d streak %d; want 100 and 1", p.Total, p.FarkleStreak)
+				}
+				if p := g.Players[1]; p.Total != -500 || p.FarkleStreak != 0 {
+					t.Errorf("player 1 total %d streak %d; want -500 and 0", p.Total, p.FarkleStreak)
+				}
+			},
+		},
+		{
+			name: "no penalty when disabled", players: 1, faces: farkleRoll,
+			steps: []engineStep{
+				{do: "roll"},
+				{do: "roll"},
+				{do: "roll", ev: []EventType{EvRoll, EvFarkle, EvTurn}},
+			},
+			check: func(t *testing.T, g *Game) {
+				if p := g.Players[0]; p.Total != 0 || p.FarkleStreak != 3 {
+					t.Errorf("total %d streak %d; want 0 and 3", p.Total, p.FarkleStreak)
+				}
+			},
+		},
+		{
+			name: "final round", players: 3, faces: rolls(farkleRoll, farkleRoll, hotRoll, farkleRoll, hotRoll),
+			opts: Options{FinalRound: true},
+			steps: []engineStep{
+				{do: "roll"},
+				{do: "roll"},
+				{do: "roll"},
+				{do: "bank", dice: hotRoll, ev: []EventType{EvKeep, EvHot, EvBank, EvLastChance, EvTurn}},
+				{do: "roll", ev: []EventType{EvRoll, EvFarkle, EvTurn}},
+				{do: "roll"},
+				{do: "bank", dice: hotRoll, ev: []EventType{EvKeep, EvHot, EvBank, EvGameOver}},
+				{do: "roll", err: ErrGameOver},
+				{do: "bank", err: ErrGameOver},
+			},
+			check: func(t *testing.T, g *Game) {
+				// The closer keeps a tie, even against an earlier seat.
+				want := []Standing{{2, "P2", 1500}, {1, "P1", 1500}, {0, "P0", 0}}
+				if got := g.Standings(); !slices.Equal(got, want) || g.Winner != 2 || g.Closer != 2 {
+					t.Errorf("standings %v, winner %d, closer %d; want %v won by the closer 2", got, g.Winner, g.Closer, want)
+				}
+			},
+		},
+		{
+			name: "final round beaten", players: 3, faces: rolls(hotRoll, hotRoll, oneRoll, farkleRoll),
+			opts: Options{FinalRound: true},
+			steps: []engineStep{
+				{do: "roll"},
+				{do: "bank", dice: hotRoll},
+				{do: "roll"},
+				{do: "keep", dice: hotRoll},
+				{do: "roll"},
+				{do: "bank", dice: []int{1}, ev: []EventType{EvKeep, EvBank, EvTurn}},
+				{do: "roll", ev: []EventType{EvRoll, EvFarkle, EvGameOver}},
+			},
+			check: func(t *testing.T, g *Game) {
+				want := []Standing{{1, "P1", 1600}, {0, "P0", 1500}, {2, "P2", 0}}
+				if got := g.Standings(); !slices.Equal(got, want) || g.Winner != 1 {
+					t.Errorf("standings %v, winner %d; want %v", got, g.Winner, want)
+				}
+			},
+		},
+		{
+			name: "standings ties keep turn order", players: 3, faces: rolls(oneRoll, oneRoll, oneRoll),
+			steps: []engineStep{
+				{do: "roll"},
+				{do: "bank", dice: []int{1}},
+				{do: "roll"},
+				{do: "bank", dice: []int{1}},
+				{do: "roll"},
+				{do: "bank", dice: []int{1}},
+			},
+			check: func(t *testing.T, g *Game) {
+				want := []Standing{{0, "P0", 100}, {1, "P1", 100}, {2, "P2", 100}}
+				if got := g.Standings(); !slices.Equal(got, want) {
+					t.Errorf("standings %v, want %v", got, want)
+				}
+			},
+		},
+		{
+			name: "forfeits", players: 3, faces: rolls(hotRoll, oneRoll),
+			steps: []engineStep{
+				{do: "roll"},
+				{do: "keep", dice: hotRoll},
+				{do: "forfeit", who: 1, ev: []EventType{EvForfeit}},
+				{do: "forfeit", who: 1},
+				{do: "bank", ev: []EventType{EvBank, EvGameOver}},
+			},
+			check: func(t *testing.T, g *Game) {
+				want := []Standing{{0, "P0", 1500}, {2, "P2", 0}, {1, "P1", 0}}
+				if got := g.Standings(); !slices.Equal(got, want) {
+					t.Errorf("standings %v, want %v", got, want)
+				}
+			},
+		},
+		{
+			name: "forfeit skips the seat", players: 3, faces: oneRoll,
+			opts: Options{Target: 10000},
+			steps: []engineStep{
+				{do: "forfeit", who: 1, ev: []EventType{EvForfeit}},
+				{do: "roll"},
+				{do: "bank", dice: []int{1}, ev: []EventType{EvKeep, EvBank, EvTurn}},
+			},
+			check: func(t *testing.T, g *Game) {
+				if g.Turn.Idx != 2 {
+					t.Errorf("turn passed to %d, want 2", g.Turn.Idx)
+				}
+			},
+		},
+		{
+			name: "forfeit on your own turn", players: 3, faces: rolls(oneRoll, oneRoll),
+			opts: Options{Target: 10000},
+			steps: []engineStep{
+				{do: "roll"},
+				{do: "keep", dice: []int{1}},
+				{do: "forfeit", who: 0, ev: []EventType{EvForfeit, EvTurn}},
+				{do: "roll"},
+				{do: "bank", dice: []int{1}},
+				{do: "forfeit", who: 2, ev: []EventType{EvForfeit, EvGameOver}},
+			},
+			check: func(t *testing.T, g *Game) {
+				if g.Players[0].Total != 0 || !g.Over || g.Winner != 1 {
+					t.Errorf("player 0 total %d, over %v, winner %d; want 0, true, 1", g.Players[0].Total, g.Over, g.Winner)
+				}
+			},
+		},
+		{
+			name: "last player standing wins behind", players: 2, faces: hotRoll,
+			opts: Options{Target: 10000},
+			steps: []engineStep{
+				{do: "roll"},
+				{do: "bank", dice: []int{1, 1, 1}},
+				{do: "roll"},
+				{do: "bank", dice: hotRoll},
+				{do: "forfeit", who: 1, ev: []EventType{EvForfeit, EvGameOver}},
+			},
+			check: func(t *testing.T, g *Game) {
+				if !g.Over || g.Winner != 0 {
+					t.Errorf("over %v, winner %d; want player 0 to win", g.Over, g.Winner)
+				}
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var players []Player
+			for i := 0; i < tt.players; i++ {
+				players = append(players, Player{Name: "P" + string(rune('0'+i))})
+			}
+			opts := tt.opts
+			opts.Dice = &ScriptedDice{Faces: tt.faces}
+			g := NewGame(opts, players...)
+			for n, s := range tt.steps {
+				var events []Event
+				var err error
+				switch s.do {
+				case "roll":
+					events, err = g.Roll()
+				case "keep":
+					events, err = g.Keep(s.dice)
+				case "bank":
+					events, err = g.Bank(s.dice)
+				case "forfeit":
+					events = g.Forfeit(s.who)
+				}
+				switch {
+				case s.err == nil && err != nil:
+					t.Fatalf("step %d (%s %v): %v", n, s.do, s.dice, err)
+				case s.err != nil && !sameError(err, s.err):
+					t.Fatalf("step %d (%s %v): err = %v, want %v", n, s.do, s.dice, err, s.err)
+				}
+				if s.ev != nil && !slices.Equal(types(events), s.ev) {
+					t.Fatalf("step %d (%s %v): events %v, want %v", n, s.do, s.dice, types(events), s.ev)
+				}
+			}
+			tt.check(t, g)
+		})
+	}
+}
+
+func TestValidateKeep(t *testing.T) {
+	for _, tt := range []struct {
+		roll, dice []int
+		dead       []int // nil when the keep is not a dead-dice error
+		ok         bool
+	}{
+		{oneRoll, []int{1}, nil, true},
+		{hotRoll, hotRoll, nil, true},
+		{[]int{1, 2, 3, 4, 5, 6}, []int{1, 2, 3, 4, 5, 6}, nil, true},
+		{oneRoll, nil, nil, false},
+		{oneRoll, []int{1, 1}, nil, false},
+		{oneRoll, []int{5}, nil, false},
+		{oneRoll, []int{7}, nil, false},
+		{oneRoll, []int{1, 6}, []int{6}, false},
+		{oneRoll, []int{1, 6, 6}, []int{6, 6}, false},
+	} {
+		err := ClassicRules.ValidateKeep(tt.roll, tt.dice)
+		var dead *DeadDiceError
+		switch {
+		case tt.ok && err != nil:
+			t.Errorf("keep %v from %v: %v", tt.dice, tt.roll, err)
+		case !tt.ok && err == nil:
+			t.Errorf("keep %v from %v accepted", tt.dice, tt.roll)
+		case errors.As(err, &dead) != (tt.dead != nil):
+			t.Errorf("keep %v from %v: err = %v, want dead dice %v", tt.dice, tt.roll, err, tt.dead)
+		case dead != nil && !slices.Equal(dead.Dice, tt.dead):
+			t.Errorf("keep %v from %v: dead dice %v, want %v", tt.dice, tt.roll, dead.Dice, tt.dead)
+		}
+	}
+}
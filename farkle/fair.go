@@ -0,0 +1,292 @@
+package farkle
+
+import (
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// MARK: Fair dice
+
+// Fair dice are drawn from hash chains. Every seat picks a secret seed and
+// hashes it chainLength times; the last hash is its commitment, published
+// before the first roll. For roll n every seat reveals the hash n steps
+// back from its commitment, its link for that roll, which anyone can check
+// by hashing it onto the link it revealed before. A link is fixed by the
+// commitment but cannot be worked out from the links already revealed, so
+// nobody, the host included, knows a roll before every seat has revealed
+// its link for it, and nobody can pick a link to steer one.
+//
+// Roll n is drawn from SHA-256(SHA-256(every seat's link) ‖ n ‖ block), with
+// zeros standing in for a seat that has left the game.
+
+const (
+	seedBytes   = 32
+	chainLength = 1 << 15 // rolls one commitment covers
+)
+
+// FairChain is one player's secret hash chain.
+type FairChain struct {
+	links [][sha256.Size]byte // links[n] is revealed for roll n; links[0] is the commitment
+}
+
+// NewFairChain picks a secret seed and hashes out its chain.
+func NewFairChain() *FairChain {
+	c := &FairChain{links: make([][sha256.Size]byte, chainLength+1)}
+	if _, err := crand.Read(c.links[chainLength][:seedBytes]); err != nil {
+		panic("farkle: crypto/rand unavailable: " + err.Error())
+	}
+	for n := chainLength; n > 0; n-- {
+		c.links[n-1] = sha256.Sum256(c.links[n][:])
+	}
+	return c
+}
+
+// Commit is the commitment to publish before the first roll.
+func (c *FairChain) Commit() string {
+	return hex.EncodeToString(c.links[0][:])
+}
+
+// Link is the link to reveal for roll n, or false once the chain is spent.
+func (c *FairChain) Link(n int) (string, bool) {
+	if n < 1 || n > chainLength {
+		return "", false
+	}
+	return hex.EncodeToString(c.links[n][:]), true
+}
+
+// chainCheck remembers the last link each seat revealed, starting from the
+// commitments, and checks new links against it.
+type chainCheck struct {
+	last []string
+	at   []int // roll each last link was revealed for
+}
+
+func newChainCheck(commits []string) (chainCheck, error) {
+	if len(commits) == 0 {
+		return chainCheck{}, errors.New("fair dice: no commitments")
+	}
+	for i, c := range commits {
+		if raw, err := hex.DecodeString(c); err != nil || len(raw) != sha256.Size {
+			return chainCheck{}, fmt.Errorf("fair dice: commitment %d is malformed", i+1)
+		}
+	}
+	return chainCheck{last: slices.Clone(commits), at: make([]int, len(commits))}, nil
+}
+
+// follows reports whether link is seat's link for roll n.
+func (c *chainCheck) follows(seat int, link string, n int) bool {
+	raw, err := hex.DecodeString(link)
+	if err != nil || len(raw) != sha256.Size || n <= c.at[seat] || n-c.at[seat] > chainLength {
+		return false
+	}
+	for i := c.at[seat]; i < n; i++ {
+		sum := sha256.Sum256(raw)
+		raw = sum[:]
+	}
+	return hex.EncodeToString(raw) == c.last[seat]
+}
+
+// accept checks the links revealed for roll n, "" for seats out of the
+// draw, and remembers them.
+func (c *chainCheck) accept(links []string, n int) error {
+	switch {
+	case len(links) != len(c.last):
+		return fmt.Errorf("%d links for %d seats", len(links), len(c.last))
+	case links[0] == "":
+		return errors.New("the host revealed no link")
+	}
+	for i, l := range links {
+		if l != "" && !c.follows(i, l, n) {
+			return fmt.Errorf("seat %d's link does not match its commitment", i+1)
+		}
+	}
+	for i, l := range links {
+		if l != "" {
+			c.last[i], c.at[i] = l, n
+		}
+	}
+	return nil
+}
+
+// drawDice derives n dice for roll count from the links revealed for it.
+func drawDice(links []string, count, n int) []int {
+	h := sha256.New()
+	for _, l := range links {
+		var link [sha256.Size]byte
+		hex.Decode(link[:], []byte(l))
+		h.Write(link[:])
+	}
+	dice := make([]int, 0, n)
+	var msg [32 + 8 + 4]byte
+	copy(msg[:], h.Sum(nil))
+	binary.BigEndian.PutUint64(msg[32:], uint64(count))
+	for block := uint32(0); len(dice) < n; block++ {
+		binary.BigEndian.PutUint32(msg[40:], block)
+		sum := sha256.Sum256(msg[:])
+		for _, b := range sum {
+			// 252 is the largest multiple of 6 below 256; reject to stay unbiased.
+			if b < 252 && len(dice) < n {
+				dice = append(dice, int(b%6)+1)
+			}
+		}
+	}
+	return dice
+}
+
+// FairDice is the host's DiceSource for fair dice. Each roll gathers the
+// other seats' links through Gather, adds the host's own last, and keeps
+// them so the roll message can carry them to every client.
+type FairDice struct {
+	Commits []string // each seat's commitment, in seat order
+	Links   []string // each seat's link for the latest roll; "" for seats out of the draw
+	Count   int      // rolls made so far
+
+	// Gather returns the links for roll n in seat order, the host's left
+	// empty, each checked with follows. Nil means the host is the only seat.
+	Gather func(n int) []string
+
+	own   *FairChain
+	check chainCheck
+}
+
+// NewFairDice starts fair dice for the published commitments; own is the
+// host's chain, committed as seat 1.
+func NewFairDice(commits []string, own *FairChain) (*FairDice, error) {
+	check, err := newChainCheck(commits)
+	if err != nil {
+		return nil, err
+	}
+	if commits[0] != own.Commit() {
+		return nil, errors.New("fair dice: the host's commitment is not its own")
+	}
+	return &FairDice{Commits: commits, own: own, check: check}, nil
+}
+
+// follows reports whether link is seat's link for roll n.
+func (f *FairDice) follows(seat int, link string, n int) bool {
+	return f.check.follows(seat, link, n)
+}
+
+func (f *FairDice) Roll(n int) []int {
+	count := f.Count + 1
+	links := make([]string, len(f.Commits))
+	if f.Gather != nil {
+		links = f.Gather(count)
+	}
+	link, ok := f.own.Link(count)
+	if !ok {
+		panic(fmt.Sprintf("farkle: fair dice spent after %d rolls", chainLength))
+	}
+	links[0] = link
+	f.check.accept(links, count)
+	f.Links, f.Count = links, count
+	return drawDice(links, count, n)
+}
+
+// MARK: Verification
+
+// RollCheck checks a stream of announced rolls against the links revealed
+// for them and the commitments published before the first.
+type RollCheck struct {
+	Commits   []string
+	Count     int // latest roll checked or skipped
+	Matched   int
+	Mismatch  int
+	Unchecked int // rolls missed while disconnected or before joining
+	chain     chainCheck
+}
+
+// NewRollCheck starts checking rolls against commits.
+func NewRollCheck(commits []string) (*RollCheck, error) {
+	chain, err := newChainCheck(commits)
+	if err != nil {
+		return nil, err
+	}
+	return &RollCheck{Commits: commits, chain: chain}, nil
+}
+
+// Check verifies roll count: every revealed link must follow its seat's
+// chain and dice must be what those links draw.
+func (c *RollCheck) Check(count int, links []string, dice []int) error {
+	c.SkipTo(count - 1)
+	c.Count = max(c.Count, count)
+	err := c.chain.accept(links, count)
+	if err == nil && !slices.Equal(drawDice(links, count, len(dice)), dice) {
+		err = errors.New("the dice do not follow from the revealed links")
+	}
+	if err != nil {
+		c.Mismatch++
+		return err
+	}
+	c.Matched++
+	return nil
+}
+
+// SkipTo fast-forwards to count rolls, counting the ones not seen.
+func (c *RollCheck) SkipTo(count int) {
+	if count > c.Count {
+		c.Unchecked += count - c.Count
+		c.Count = count
+	}
+}
+
+// Summary is the end-of-game verdict on the dice.
+func (c *RollCheck) Summary() string {
+	var b strings.Builder
+	switch {
+	case c.Mismatch > 0:
+		fmt.Fprintf(&b, ColorRed+"Fair dice: %d of %d rolls did NOT follow from the revealed links."+ColorReset, c.Mismatch, c.Matched+c.Mismatch)
+	default:
+		fmt.Fprintf(&b, ColorGreen+"Fair dice: all %d rolls followed from the revealed links."+ColorReset, c.Matched)
+	}
+	if c.Unchecked > 0 {
+		fmt.Fprintf(&b, " (%d rolls were not seen and could not be checked.)", c.Unchecked)
+	}
+	for i, s := range c.Commits {
+		fmt.Fprintf(&b, "\n  seat %d commitment %s", i+1, s)
+	}
+	return b.String()
+}
+
+// VerifyLog replays the fair-dice commitments and every roll of a game log
+// offline, reporting an error if any roll does not follow from them.
+func VerifyLog(path string) error {
+	entries, err := ReadLog(path)
+	if err != nil {
+		return err
+	}
+	var check *RollCheck
+	for _, e := range entries {
+		switch e.T {
+		case "commits", "snapshot":
+			if check != nil || len(e.Commits) == 0 {
+				break
+			}
+			if check, err = NewRollCheck(e.Commits); err != nil {
+				return err
+			}
+			check.SkipTo(e.Count)
+		case "roll":
+			if check == nil {
+				break
+			}
+			if err := check.Check(e.Count, e.Links, e.Dice); err != nil {
+				fmt.Printf(ColorRed+"Roll %d (%s, round %d): got %v: %v"+ColorReset+"\n", e.Count, e.Time.Local().Format("15:04:05"), e.Round, e.Dice, err)
+			}
+		}
+	}
+	if check == nil {
+		return fmt.Errorf("%s has no fair-dice commitments", path)
+	}
+	fmt.Println(check.Summary())
+	if check.Mismatch > 0 {
+		return fmt.Errorf("%d rolls do not follow from the commitments", check.Mismatch)
+	}
+	return nil
+}
@@ -0,0 +1,239 @@
+package farkle
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// fairChains returns n seats' chains and their commitments.
+func fairChains(n int) (chains []*FairChain, commits []string) {
+	for i := 0; i < n; i++ {
+		c := NewFairChain()
+		chains, commits = append(chains, c), append(commits, c.Commit())
+	}
+	return chains, commits
+}
+
+// gatherFrom reveals every seat's link but the host's, as honest clients do.
+func gatherFrom(chains []*FairChain) func(n int) []string {
+	return func(n int) []string {
+		links := make([]string, len(chains))
+		for i, c := range chains[1:] {
+			links[i+1], _ = c.Link(n)
+		}
+		return links
+	}
+}
+
+func TestFairChain(t *testing.T) {
+	c := NewFairChain()
+	check, err := newChainCheck([]string{c.Commit()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, n := range []int{1, 2, 5, 6} {
+		link, ok := c.Link(n)
+		if !ok || !check.follows(0, link, n) {
+			t.Fatalf("link %d does not follow the commitment", n)
+		}
+		if err := check.accept([]string{link}, n); err != nil {
+			t.Fatalf("link %d: %v", n, err)
+		}
+	}
+	if link, _ := c.Link(6); check.follows(0, link, 7) {
+		t.Error("a revealed link was accepted again for a later roll")
+	}
+	if link, _ := NewFairChain().Link(7); check.follows(0, link, 7) {
+		t.Error("another chain's link was accepted")
+	}
+	if _, ok := c.Link(chainLength + 1); ok {
+		t.Error("link past the end of the chain")
+	}
+}
+
+func TestNewFairDiceChecksCommitments(t *testing.T) {
+	chains, commits := fairChains(3)
+	if _, err := NewFairDice(commits, chains[0]); err != nil {
+		t.Fatalf("honest commitments rejected: %v", err)
+	}
+	if _, err := NewFairDice(commits, chains[1]); err == nil {
+		t.Error("host chain that is not seat 1's commitment accepted")
+	}
+	malformed := slices.Clone(commits)
+	malformed[2] = "abc"
+	if _, err := NewFairDice(malformed, chains[0]); err == nil || !strings.Contains(err.Error(), "commitment 3 is malformed") {
+		t.Errorf("malformed commitment: err = %v", err)
+	}
+	if _, err := NewFairDice(nil, chains[0]); err == nil {
+		t.Error("no commitments accepted")
+	}
+}
+
+func TestFairDiceDeterministic(t *testing.T) {
+	chains, commits := fairChains(2)
+	a, _ := NewFairDice(commits, chains[0])
+	b, _ := NewFairDice(commits, chains[0])
+	a.Gather, b.Gather = gatherFrom(chains), gatherFrom(chains)
+	for n := 1; n <= 200; n++ {
+		ra, rb := a.Roll(n%6+1), b.Roll(n%6+1)
+		if !slices.Equal(ra, rb) {
+			t.Fatalf("roll %d: %v and %v from the same links", n, ra, rb)
+		}
+		for _, d := range ra {
+			if d < 1 || d > 6 {
+				t.Fatalf("roll %d: die %d out of range", n, d)
+			}
+		}
+	}
+	if a.Count != 200 || len(a.Links) != 2 || a.Links[1] == "" {
+		t.Errorf("after 200 rolls: Count %d, Links %q", a.Count, a.Links)
+	}
+
+	chains2, commits2 := fairChains(2)
+	c, _ := NewFairDice(commits2, chains2[0])
+	d, _ := NewFairDice(commits, chains[0])
+	c.Gather, d.Gather = gatherFrom(chains2), gatherFrom(chains)
+	same := true
+	for n := 1; n <= 10; n++ {
+		same = slices.Equal(c.Roll(6), d.Roll(6)) && same
+	}
+	if same {
+		t.Error("different chains gave the same dice")
+	}
+}
+
+func TestRollCheck(t *testing.T) {
+	chains, commits := fairChains(3)
+	links := func(n int, gone ...int) []string {
+		out := make([]string, len(chains))
+		for i, c := range chains {
+			if !slices.Contains(gone, i) {
+				out[i], _ = c.Link(n)
+			}
+		}
+		return out
+	}
+
+	check, _ := NewRollCheck(commits)
+	for n := 1; n <= 3; n++ {
+		if err := check.Check(n, links(n), drawDice(links(n), n, 6)); err != nil {
+			t.Fatalf("honest roll %d: %v", n, err)
+		}
+	}
+	// Seat 3 leaves; its link is out of the draw but the rest still chain on.
+	if err := check.Check(4, links(4, 2), drawDice(links(4, 2), 4, 5)); err != nil {
+		t.Errorf("roll without a departed seat: %v", err)
+	}
+
+	tampered := links(5)
+	tampered[1] = tampered[0]
+	if err := check.Check(5, tampered, drawDice(tampered, 5, 6)); err == nil || !strings.Contains(err.Error(), "seat 2's link") {
+		t.Errorf("swapped link: err = %v", err)
+	}
+	if err := check.Check(6, links(6, 0), drawDice(links(6, 0), 6, 6)); err == nil || !strings.Contains(err.Error(), "no link") {
+		t.Errorf("roll without the host's link: err = %v", err)
+	}
+	dice := drawDice(links(7), 7, 6)
+	dice[0] = dice[0]%6 + 1
+	if err := check.Check(7, links(7), dice); err == nil || !strings.Contains(err.Error(), "dice do not follow") {
+		t.Errorf("changed die: err = %v", err)
+	}
+	if check.Matched != 4 || check.Mismatch != 3 {
+		t.Errorf("Matched %d, Mismatch %d; want 4 and 3", check.Matched, check.Mismatch)
+	}
+
+	// A spectator who joins late checks from where it came in.
+	late, _ := NewRollCheck(commits)
+	late.SkipTo(7)
+	if err := late.Check(8, links(8), drawDice(links(8), 8, 6)); err != nil || late.Unchecked != 7 {
+		t.Errorf("late checker: err %v, Unchecked %d", err, late.Unchecked)
+	}
+}
+
+// writeFairLog plays a bot game on fair dice and logs it the way a host does.
+func writeFairLog(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "fair.jsonl")
+	log, err := CreateLog(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chains, commits := fairChains(2)
+	fd, err := NewFairDice(commits, chains[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd.Gather = gatherFrom(chains)
+	easy, _ := NewStrategy("easy")
+	g := NewGame(Options{Target: 2000, Dice: fd, Recorder: log}, Player{Name: "Host", Bot: easy}, Player{Name: "Peer", Bot: easy})
+	log.Start([]string{"Host", "Peer"}, NetMsg{Target: g.Target, Fair: true})
+	log.Message(NetMsg{T: "commits", Commits: commits})
+	for !g.Over {
+		playBotTurn(t, g)
+	}
+	if err := log.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// rewriteLog applies edit to every line of the log at path.
+func rewriteLog(t *testing.T, path string, edit func(line string) string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line = edit(line); line != "" {
+			out = append(out, line)
+		}
+	}
+	if err := os.WriteFile(path, []byte(strings.Join(out, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerifyLog(t *testing.T) {
+	t.Run("clean", func(t *testing.T) {
+		if err := VerifyLog(writeFairLog(t)); err != nil {
+			t.Errorf("clean log failed: %v", err)
+		}
+	})
+
+	t.Run("die changed", func(t *testing.T) {
+		path := writeFairLog(t)
+		changed := false
+		rewriteLog(t, path, func(line string) string {
+			if changed || !strings.Contains(line, `"t":"roll"`) {
+				return line
+			}
+			i := strings.Index(line, `"dice":[`) + len(`"dice":[`)
+			changed = true
+			return line[:i] + string('1'+(line[i]-'0')%6) + line[i+1:]
+		})
+		if !changed {
+			t.Fatal("log has no roll to change")
+		}
+		if err := VerifyLog(path); err == nil || !strings.Contains(err.Error(), "1 rolls do not follow") {
+			t.Errorf("log with a changed die: err = %v", err)
+		}
+	})
+
+	t.Run("commitments missing", func(t *testing.T) {
+		path := writeFairLog(t)
+		rewriteLog(t, path, func(line string) string {
+			if strings.Contains(line, `"t":"commits"`) {
+				return ""
+			}
+			return line
+		})
+		if err := VerifyLog(path); err == nil || !strings.Contains(err.Error(), "no fair-dice commitments") {
+			t.Errorf("log without the commitments: err = %v", err)
+		}
+	})
+}
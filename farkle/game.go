@@ -3,10 +3,10 @@ package farkle
 import (
     "bufio"
     "fmt"
-    "math/rand"
     "os"
     "strconv"
     "strings"
+    "sync"
     "time"
 )
 
@@ -19,12 +19,45 @@ const (
     ColorBlue   = "\033[34m"
 )
 
-var WinningScore = 1000
 var aiDelay = 2 * time.Second
 
+// stdin is read by a single goroutine so the menu, every in-game prompt and
+// the lobbies (which wait on typed commands and the network at once) share
+// one ordered stream of lines.
+var (
+    stdin     = bufio.NewScanner(os.Stdin)
+    lines     = make(chan string)
+    linesOnce sync.Once
+)
+
+// Lines is the shared stream of input lines; it is closed at EOF.
+func Lines() <-chan string {
+    linesOnce.Do(func() {
+        go func() {
+            for stdin.Scan() {
+                lines <- stdin.Text()
+            }
+            close(lines)
+        }()
+    })
+    return lines
+}
+
+// ReadLine blocks for the next input line; ok is false at EOF.
+func ReadLine() (line string, ok bool) {
+    line, ok = <-Lines()
+    return line, ok
+}
+
 type Player struct {
-    Name  string
-    Total int
+    Name    string
+    Total   int
+    OnBoard bool // has made the opening bank
+
+    FarkleStreak int  // consecutive farkled turns
+    Out          bool // forfeited: skipped and cannot win
+
+    Bot Strategy `json:"-"` // nil for human players
 }
 
 var dieFaces = map[int]string{
@@ -37,208 +70,188 @@ var dieFaces = map[int]string{
 }
 
 // MARK: Main game loop
-func PlayGame() {
-    rand.Seed(time.Now().UnixNano())
-
-    player := Player{Name: "You"}
-    enemy := Player{Name: "Enemy"}
-
-    round := 1
-    for {
-        fmt.Printf("\n========================\n")
-        fmt.Printf(" ROUND %d – First to %d\n", round, WinningScore)
-        fmt.Printf("========================\n")
-        fmt.Printf("Scoreboard → %sYou%s: %d | %sEnemy%s: %d\n",
-            ColorGreen, ColorReset, player.Total,
-            ColorRed, ColorReset, enemy.Total)
-
-        fmt.Println("\n" + ColorGreen + "Your turn:" + ColorReset)
-        fmt.Println(ColorYellow + "First roll will happen automatically; then choose dice to keep or bank." + ColorReset)
-        playerPoints := playerTurn()
-        player.Total += playerPoints
-        fmt.Printf("You banked %d points. New total: %d\n", playerPoints, player.Total)
-        if player.Total >= WinningScore {
-            fmt.Println("\n" + ColorGreen + "VICTORY!" + ColorReset)
-            return
-        }
-
-        fmt.Println("\n" + ColorRed + "Enemy turn:" + ColorReset)
-        enemyPoints := enemyTurn()
-        enemy.Total += enemyPoints
-        fmt.Printf("Enemy banked %d points. New total: %d\n", enemyPoints, enemy.Total)
-        if enemy.Total >= WinningScore {
-            fmt.Println("\n" + ColorRed + "DEFEAT!" + ColorReset)
-            return
-        }
-
-        round++
+// PlayGame runs a local game: one human against the computer, or several
+// humans sharing the terminal (hot-seat), with any number of AI seats.
+func PlayGame(opts Options, players ...Player) {
+    g := NewGame(opts, players...)
+    if sd, ok := g.Dice.(*SeededDice); ok {
+        fmt.Printf(ColorBlue+"Seed: %d (replay with 'play --seed=%d')"+ColorReset+"\n", sd.Seed, sd.Seed)
     }
+    runLocal(g)
 }
 
-// MARK: Dice rolling
-func rollDice(n int) []int {
-    dice := make([]int, n)
-    for i := 0; i < n; i++ {
-        dice[i] = rand.Intn(6) + 1
+// ResumeGame continues a local game saved with the 'save' command; rec may
+// be nil.
+func ResumeGame(path string, rec Recorder) error {
+    g, err := LoadGame(path)
+    if err != nil {
+        return err
     }
-    return dice
-}
-
-// MARK: Dice rendering
-func renderDice(dice []int) {
-    for _, d := range dice {
-        fmt.Printf("%s[%s %d]%s ", ColorCyan, dieFaces[d], d, ColorReset)
+    g.Recorder = rec
+    if humans(g) == 0 {
+        return fmt.Errorf("%s has no human players", path)
     }
-    fmt.Println()
+    board := make([]string, len(g.Players))
+    for i, p := range g.Players {
+        board[i] = fmt.Sprintf("%s %d", p.Name, p.Total)
+    }
+    fmt.Printf(ColorBlue+"Resuming %s: round %d, %s"+ColorReset+"\n", path, g.Round, strings.Join(board, " – "))
+    runLocal(g)
+    return nil
 }
 
-// MARK: Score calculation
-func calculateScore(dice []int) int {
-    counts := make(map[int]int)
-    for _, d := range dice {
-        counts[d]++
+func runLocal(g *Game) {
+    fmt.Println(ColorBlue + "Rules: " + g.Rules.Name + ColorReset)
+    if g.OpeningScore > 0 {
+        fmt.Printf(ColorBlue+"Opening score: %d"+ColorReset+"\n", g.OpeningScore)
+    }
+    if g.FarklePenalty > 0 {
+        fmt.Printf(ColorBlue+"Three farkles in a row cost %d"+ColorReset+"\n", g.FarklePenalty)
     }
 
-    if len(dice) == 6 {
-        full := true
-        for i := 1; i <= 6; i++ {
-            if counts[i] != 1 {
-                full = false
-                break
-            }
-        }
-        if full {
-            return 1500
-        }
+    if g.FinalRound {
+        fmt.Println(ColorBlue + "Final round: reaching the target gives everyone else one more turn." + ColorReset)
     }
+    prepareBots(g)
+
+    solo := humans(g) == 1
+    lastChance := false
+    first := true
+    for !g.Over {
+        idx := g.Turn.Idx
+        p := g.Players[idx]
+        if first || (idx == 0 && g.Turn.Score == 0 && g.Turn.Roll == nil) {
+            printBanner(g)
+            first = false
+        }
 
-    if len(dice) == 5 {
-        isStraight15 := true
-        for i := 1; i <= 5; i++ {
-            if counts[i] != 1 {
-                isStraight15 = false
-                break
+        var points int
+        if p.Bot != nil {
+            fmt.Println("\n" + ColorRed + p.Name + " turn:" + ColorReset)
+            points = enemyTurn(g)
+        } else {
+            if solo {
+                fmt.Println("\n" + ColorGreen + "Your turn:" + ColorReset)
+            } else {
+                fmt.Println("\n" + ColorGreen + p.Name + "'s turn:" + ColorReset)
             }
-        }
-        if isStraight15 {
-            return 500
-        }
-        isStraight26 := true
-        for i := 2; i <= 6; i++ {
-            if counts[i] != 1 {
-                isStraight26 = false
-                break
+            if g.Turn.Roll == nil {
+                fmt.Println(ColorYellow + "First roll will happen automatically; then choose dice to keep or bank." + ColorReset)
             }
+            points = playerTurn(g)
         }
-        if isStraight26 {
-            return 750
+        who := p.Name
+        if solo && p.Bot == nil {
+            who = "You"
         }
+        fmt.Printf("%s banked %d points. New total: %d\n", who, points, g.Players[idx].Total)
+        announceLastChance(g, &lastChance)
     }
 
-    score := 0
-    for val, cnt := range counts {
-        if cnt >= 3 {
-            base := 0
-            if val == 1 {
-                base = 1000
-            } else {
-                base = val * 100
-            }
-            mult := 1 << (cnt - 3)
-            score += base * mult
-            cnt = 0
-        }
-        if val == 1 {
-            score += cnt * 100
-        } else if val == 5 {
-            score += cnt * 50
-        }
+    printStandings(g.Standings())
+    switch winner := g.Players[g.Winner]; {
+    case !solo:
+        fmt.Println("\n" + ColorGreen + winner.Name + " wins!" + ColorReset)
+    case winner.Bot == nil:
+        fmt.Println("\n" + ColorGreen + "VICTORY!" + ColorReset)
+    default:
+        fmt.Println("\n" + ColorRed + "DEFEAT!" + ColorReset)
     }
-    return score
 }
 
-// MARK: AI scoring dice selection
-func aiSelectScoringDice(roll []int) (kept []int) {
-    counts := make(map[int]int)
-    for _, d := range roll {
-        counts[d]++
+// printBanner shows the round header and every player's score.
+func printBanner(g *Game) {
+    fmt.Printf("\n========================\n")
+    fmt.Printf(" ROUND %d – First to %d\n", g.Round, g.Target)
+    fmt.Printf("========================\n")
+    board := make([]string, len(g.Players))
+    for i, p := range g.Players {
+        if p.Bot != nil {
+            board[i] = fmt.Sprintf("%s%s%s (%s): %d%s", ColorRed, p.Name, ColorReset, p.Bot.Name(), p.Total, scoreNote(g, i))
+        } else {
+            board[i] = fmt.Sprintf("%s%s%s: %d%s", ColorGreen, p.Name, ColorReset, p.Total, scoreNote(g, i))
+        }
     }
+    fmt.Println("Scoreboard → " + strings.Join(board, " | "))
+}
 
-    full := true
-    for i := 1; i <= 6; i++ {
-        if counts[i] != 1 {
-            full = false
-            break
+// humans counts the players without a Bot.
+func humans(g *Game) int {
+    n := 0
+    for _, p := range g.Players {
+        if p.Bot == nil {
+            n++
         }
     }
-    if full {
-        return roll
+    return n
+}
+
+// announceLastChance prints the final-round notice the first time it applies.
+func announceLastChance(g *Game, shown *bool) {
+    if !g.LastChance || *shown {
+        return
     }
+    *shown = true
+    closer := g.Players[g.Closer]
+    fmt.Printf(ColorYellow+"Final round! %s reached %d – everyone else gets one more turn to beat it."+ColorReset+"\n", closer.Name, closer.Total)
+}
 
-    if len(roll) >= 5 {
-        part15 := true
-        for i := 1; i <= 5; i++ {
-            if counts[i] == 0 {
-                part15 = false
-                break
-            }
-        }
-        if part15 {
-            for _, d := range roll {
-                if d != 6 {
-                    kept = append(kept, d)
-                }
-            }
-            return
-        }
-        part26 := true
-        for i := 2; i <= 6; i++ {
-            if counts[i] == 0 {
-                part26 = false
-                break
-            }
-        }
-        if part26 {
-            for _, d := range roll {
-                if d != 1 {
-                    kept = append(kept, d)
-                }
-            }
-            return
-        }
+func printStandings(standings []Standing) {
+    fmt.Println("\n" + ColorCyan + "Final standings:" + ColorReset)
+    for i, s := range standings {
+        fmt.Printf("  %d. %-10s %d\n", i+1, s.Name, s.Total)
     }
+}
 
-    for val, cnt := range counts {
-        if cnt >= 3 {
-            for i := 0; i < cnt; i++ {
-                kept = append(kept, val)
-            }
-        } else if val == 1 || val == 5 {
-            for i := 0; i < cnt; i++ {
-                kept = append(kept, val)
-            }
-        }
+// MARK: Dice rendering
+func renderDice(dice []int) {
+    for _, d := range dice {
+        fmt.Printf("%s[%s %d]%s ", ColorCyan, dieFaces[d], d, ColorReset)
     }
-    return
+    fmt.Println()
 }
 
 // MARK: Player action prompt
-func promptAction(roll []int) (kept []int, action string) {
-    scanner := bufio.NewScanner(os.Stdin)
+// promptAction reads keep/bank commands for roll. turn and minBank feed the
+// 'hint' command (minBank is the opening score while off the board); save
+// handles 'save <file>' and is nil where games cannot be saved.
+func promptAction(rules *ScoringRules, roll []int, turn, minBank int, save func(path string) error) (kept []int, action string) {
     for {
         fmt.Print("> ")
-        if !scanner.Scan() {
+        line, ok := ReadLine()
+        if !ok {
             os.Exit(0)
         }
-        input := strings.TrimSpace(scanner.Text())
+        input := strings.TrimSpace(line)
         lower := strings.ToLower(input)
 
         if lower == "quit" || lower == "exit" {
             return nil, "quit"
         }
 
+        if lower == "hint" {
+            printHint(Advise(rules, roll, turn, minBank))
+            continue
+        }
+
+        if lower == "save" || strings.HasPrefix(lower, "save ") {
+            parts := strings.Fields(input)[1:]
+            switch {
+            case save == nil:
+                fmt.Println("Only solo games can be saved.")
+            case len(parts) != 1:
+                fmt.Println("Specify a file to save to, e.g., 'save game.json'.")
+            default:
+                if err := save(parts[0]); err != nil {
+                    fmt.Println(ColorRed + "Save failed: " + err.Error() + ColorReset)
+                } else {
+                    fmt.Printf(ColorGreen+"Game saved; resume with 'play --resume=%s'."+ColorReset+"\n", parts[0])
+                }
+            }
+            continue
+        }
+
         parseDice := func(parts []string) ([]int, bool) {
-            req := make(map[int]int)
             var vals []int
             for _, p := range parts {
                 val, err := strconv.Atoi(p)
@@ -246,21 +259,10 @@ func promptAction(roll []int) (kept []int, action string) {
                     fmt.Println("Invalid die value:", p)
                     return nil, false
                 }
-                req[val]++
                 vals = append(vals, val)
             }
-            avail := make(map[int]int)
-            for _, d := range roll {
-                avail[d]++
-            }
-            for val, cnt := range req {
-                if cnt > avail[val] {
-                    fmt.Printf("Cannot keep %d of '%d'; only %d available.\n", cnt, val, avail[val])
-                    return nil, false
-                }
-            }
-            if calculateScore(vals) == 0 {
-                fmt.Println("Selected dice do not form a scoring combination.")
+            if err := rules.ValidateKeep(roll, vals); err != nil {
+                fmt.Println(capitalize(err.Error()) + ".")
                 return nil, false
             }
             return vals, true
@@ -288,90 +290,213 @@ func promptAction(roll []int) (kept []int, action string) {
             continue
         }
 
-        fmt.Println(ColorBlue + "Commands: 'keep X X...' (score & continue), 'bank X X...' (score & pass), or 'quit'" + ColorReset)
+        fmt.Println(ColorBlue + "Commands: 'keep X X...' (score & continue), 'bank X X...' (score & pass), 'hint', 'save <file>', or 'quit'" + ColorReset)
     }
 }
 
 // MARK: Player turn logic
-func playerTurn() int {
-    diceToRoll := 6
-    turnScore := 0
-
-outer:
+func playerTurn(g *Game) int {
+    save := func(path string) error { return SaveGame(g, path) }
     for {
-        fmt.Printf("-- Rolling %d dice --\n", diceToRoll)
-        roll := rollDice(diceToRoll)
-        renderDice(roll)
-
-        if calculateScore(roll) == 0 {
+        if g.Turn.Roll != nil {
+            // Resumed from a save: the roll on the table still needs a keep.
+            fmt.Printf("-- Your roll with %d dice --\n", len(g.Turn.Roll))
+            renderDice(g.Turn.Roll)
+        } else if events := rollPlayer(g); hasEvent(events, EvFarkle) {
             fmt.Println(ColorRed + "Farkle! You lose all unbanked points for this turn." + ColorReset)
+            if pen, ok := findEvent(events, EvPenalty); ok {
+                fmt.Printf(ColorRed+"Third farkle in a row! You lose %d points."+ColorReset+"\n", -pen.Delta)
+            }
             return 0
         }
 
-        fmt.Println(ColorBlue + "Commands: 'keep X X...' to score & CONTINUE, 'bank X X...' to score & PASS, or 'quit'" + ColorReset)
+        fmt.Println(ColorBlue + "Commands: 'keep X X...' to score & CONTINUE, 'bank X X...' to score & PASS, 'hint' for advice, 'save <file>', or 'quit'" + ColorReset)
 
-    inner:
+    prompt:
         for {
-            kept, action := promptAction(roll)
+            kept, action := promptAction(g.Rules, g.Turn.Roll, g.Turn.Score, minBank(g), save)
             switch action {
             case "quit":
                 fmt.Println("Goodbye!")
                 os.Exit(0)
             case "keep":
-                score := calculateScore(kept)
-                turnScore += score
-                fmt.Printf(ColorGreen+"Scored %d (turn total %d). Continuing..."+ColorReset+"\n", score, turnScore)
-
-                diceToRoll -= len(kept)
-                if diceToRoll == 0 {
+                events, err := g.Keep(kept)
+                if err != nil {
+                    fmt.Println(capitalize(err.Error()) + ".")
+                    continue
+                }
+                fmt.Printf(ColorGreen+"Scored %d (turn total %d). Continuing..."+ColorReset+"\n", events[0].Delta, g.Turn.Score)
+                if hasEvent(events, EvHot) {
                     fmt.Println(ColorYellow + "Hot dice! All dice scored, rolling 6 fresh dice." + ColorReset)
-                    diceToRoll = 6
                 }
-                break inner
+                break prompt
             case "bank":
-                score := calculateScore(kept)
-                turnScore += score
-                fmt.Printf(ColorGreen+"Banking %d points (turn total %d)."+ColorReset+"\n", score, turnScore)
-                return turnScore
+                events, err := g.Bank(kept)
+                if err != nil {
+                    fmt.Println(capitalize(err.Error()) + ".")
+                    continue
+                }
+                bank, _ := findEvent(events, EvBank)
+                fmt.Printf(ColorGreen+"Banking %d points (turn total %d)."+ColorReset+"\n", events[0].Delta, bank.Delta)
+                return bank.Delta
             }
         }
-        continue outer
     }
 }
 
-// MARK: Enemy turn logic
-func enemyTurn() int {
-    diceToRoll := 6
-    turnScore := 0
+func rollPlayer(g *Game) []Event {
+    fmt.Printf("-- Rolling %d dice --\n", g.Turn.DiceLeft)
+    events, _ := g.Roll()
+    renderDice(events[0].Dice)
+    return events
+}
 
+// MARK: Enemy turn logic
+func enemyTurn(g *Game) int {
+    ai := g.Current().Bot
+    name := g.Current().Name
     for {
-        time.Sleep(aiDelay)
-        fmt.Printf("-- Enemy rolling %d dice --\n", diceToRoll)
-        time.Sleep(aiDelay)
+        // A seat taken over mid-turn may already have a roll to keep from.
+        if g.Turn.Roll == nil {
+            time.Sleep(aiDelay)
+            fmt.Printf("-- %s rolling %d dice --\n", name, g.Turn.DiceLeft)
+            time.Sleep(aiDelay)
 
-        roll := rollDice(diceToRoll)
-        renderDice(roll)
+            events, _ := g.Roll()
+            renderDice(events[0].Dice)
 
-        if calculateScore(roll) == 0 {
-            fmt.Println(ColorRed + "Enemy Farkled and scores 0." + ColorReset)
-            return 0
+            if hasEvent(events, EvFarkle) {
+                fmt.Println(ColorRed + name + " Farkled and scores 0." + ColorReset)
+                if pen, ok := findEvent(events, EvPenalty); ok {
+                    fmt.Printf(ColorRed+"%s's third farkle in a row costs %d points."+ColorReset+"\n", name, -pen.Delta)
+                }
+                return 0
+            }
         }
 
-        kept := aiSelectScoringDice(roll)
-        score := calculateScore(kept)
-        turnScore += score
-        fmt.Printf("Enemy keeps %v gaining %d (turn total %d).\n", kept, score, turnScore)
+        kept := ai.Keep(g)
+        events, err := g.Keep(kept)
+        if err != nil {
+            // A strategy that picks an illegal keep falls back to every scoring die.
+            kept, _ = g.Rules.Best(g.Turn.Roll)
+            events, _ = g.Keep(kept)
+        }
+        fmt.Printf("%s keeps %v gaining %d (turn total %d).\n", name, kept, events[0].Delta, g.Turn.Score)
 
-        diceToRoll -= len(kept)
-        if diceToRoll == 0 {
-            fmt.Println(ColorYellow + "Enemy got hot dice and will roll all 6 again!" + ColorReset)
-            diceToRoll = 6
+        if hasEvent(events, EvHot) {
+            fmt.Println(ColorYellow + name + " got hot dice and will roll all 6 again!" + ColorReset)
         }
 
-        if turnScore >= 1000 || diceToRoll <= 2 || len(kept) >= 5 {
+        if aiWantsBank(g, ai, kept) {
             time.Sleep(aiDelay)
-            fmt.Println(ColorBlue + "Enemy decides to bank." + ColorReset)
-            return turnScore
+            fmt.Println(ColorBlue + name + " decides to bank." + ColorReset)
+            events, _ = g.Bank(nil)
+            return events[0].Delta
+        }
+    }
+}
+
+// aiWantsBank asks the strategy whether to bank, within the table rules every
+// computer player has to respect.
+func aiWantsBank(g *Game, ai Strategy, kept []int) bool {
+    t := g.Turn
+    if !g.OnBoard(t.Idx) && t.Score < g.OpeningScore {
+        return false
+    }
+    if g.LastChance && g.Current().Total+t.Score <= g.leaderTotal(t.Idx) {
+        // Banking short of the leader in the final round is a guaranteed loss.
+        return false
+    }
+    if g.FarklePenalty > 0 && g.Current().FarkleStreak == farklesForPenalty-1 {
+        // One more farkle costs the penalty; take whatever is on the table.
+        return true
+    }
+    return ai.Bank(g, kept)
+}
+
+// prepareBots loads solver tables for strategies that need them up front.
+func prepareBots(g *Game) {
+    for _, p := range g.Players {
+        if h, ok := p.Bot.(*HardStrategy); ok {
+            fmt.Println(ColorBlue + "Loading the optimal policy for " + p.Name + "…" + ColorReset)
+            if h.Prepare(g) {
+                fmt.Println(ColorBlue + "Policy solved and cached for next time." + ColorReset)
+            }
+        }
+    }
+}
+
+// MARK: Hint rendering
+func printHint(a Advice) {
+    if len(a.Options) == 0 {
+        fmt.Println(ColorRed + "No scoring dice in this roll." + ColorReset)
+        return
+    }
+    fmt.Printf(ColorCyan+"Hint (turn total %d):"+ColorReset+"\n", a.Turn)
+    for i, o := range a.Options {
+        dice := strings.Trim(fmt.Sprint(o.Dice), "[]")
+        mark := ""
+        if i == 0 {
+            mark = ColorGreen + " ★" + ColorReset
         }
+        fmt.Printf("  %-14s +%-5d → %d dice left, %4.1f%% farkle  (expected %.0f)%s\n",
+            "keep "+dice, o.Points, o.DiceLeft, 100*o.FarkleChance, o.Value, mark)
+    }
+    best := a.Best()
+    dice := strings.Trim(fmt.Sprint(best.Dice), "[]")
+    if best.Roll {
+        fmt.Printf(ColorGreen+"Recommended: 'keep %s', then roll %d dice."+ColorReset+"\n", dice, best.DiceLeft)
+    } else {
+        fmt.Printf(ColorGreen+"Recommended: 'bank %s' for a turn total of %d."+ColorReset+"\n", dice, a.Turn+best.Points)
+    }
+}
+
+// minBank is the smallest turn total the current player may bank.
+func minBank(g *Game) int {
+    if g.OnBoard(g.Turn.Idx) {
+        return 0
     }
-}
\ No newline at end of file
+    return g.OpeningScore
+}
+
+// MARK: Scoreboard
+func scoreNote(g *Game, i int) string {
+    if g.Players[i].Out {
+        return ColorRed + " (forfeited)" + ColorReset
+    }
+    return boardNote(!g.OnBoard(i), g.Players[i].FarkleStreak)
+}
+
+// boardNote formats the scoreboard annotations for one player.
+func boardNote(offBoard bool, streak int) string {
+    note := ""
+    if offBoard {
+        note += ColorYellow + " (not on board)" + ColorReset
+    }
+    if streak > 0 {
+        note += ColorRed + " " + strings.Repeat("✗", streak) + ColorReset
+    }
+    return note
+}
+
+// MARK: Event helpers
+func hasEvent(events []Event, typ EventType) bool {
+    _, ok := findEvent(events, typ)
+    return ok
+}
+
+func findEvent(events []Event, typ EventType) (Event, bool) {
+    for _, ev := range events {
+        if ev.Type == typ {
+            return ev, true
+        }
+    }
+    return Event{}, false
+}
+
+func capitalize(s string) string {
+    if s == "" {
+        return s
+    }
+    return strings.ToUpper(s[:1]) + s[1:]
+}
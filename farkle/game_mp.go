@@ -2,12 +2,18 @@ package farkle
 
 import (
 	crand "crypto/rand"
+	"crypto/sha256"
 	"encoding/base32"
 	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -18,6 +24,59 @@ var b32 = base32.StdEncoding.WithPadding(base32.NoPadding)
 
 const ColorMagenta = "\033[35m"
 
+// protocolVersion is bumped whenever the messages change incompatibly;
+// hosts and clients must speak the same version.
+const protocolVersion = 1
+
+// Capabilities a client may announce in hello. The host requires
+// capHeartbeat and capSecure always, capRules for non-classic rules and
+// capFair for fair dice, and welcomes each client with the set both sides
+// support.
+const (
+	capHeartbeat = "heartbeat"
+	capSecure    = "secure"
+	capReconnect = "reconnect"
+	capRules     = "rules"
+	capSpectate  = "spectate"
+	capFair      = "fair"
+)
+
+// supportedCaps is everything this build implements.
+var supportedCaps = []string{capHeartbeat, capSecure, capReconnect, capRules, capSpectate, capFair}
+
+// capNames describe capabilities in reject messages.
+var capNames = map[string]string{
+	capHeartbeat: "heartbeats",
+	capSecure:    "the encrypted lobby handshake",
+	capReconnect: "reconnecting",
+	capRules:     "custom scoring rules",
+	capSpectate:  "spectating",
+	capFair:      "fair dice",
+}
+
+// maxRemotes caps the remote players of one lobby.
+const maxRemotes = 6
+
+// maxSpectators caps the watchers of one lobby.
+const maxSpectators = 16
+
+// maxRejects is how many illegal actions in a row end a remote turn.
+const maxRejects = 5
+
+// reconnectGrace is how long the game waits for a dropped player to redial.
+const reconnectGrace = 60 * time.Second
+
+// pairWait is how long a player who paired on the local network waits for
+// the host to admit them.
+const pairWait = 2 * time.Minute
+
+// Heartbeat: both sides ping every pingInterval, and a connection with
+// nothing to read for pongTimeout is treated as dropped.
+const (
+	pingInterval = 10 * time.Second
+	pongTimeout  = 30 * time.Second
+)
+
 //MARK: Peer Dice Render
 func renderPeerDice(dice []int) {
 	for _, d := range dice {
@@ -27,18 +86,45 @@ func renderPeerDice(dice []int) {
 }
 //MARK: NetMsg
 type NetMsg struct {
-	T         string `json:"t"`
-	Dice      []int  `json:"dice,omitempty"`
-	Keep      []int  `json:"keep,omitempty"`
-	Bank      bool   `json:"bank,omitempty"`
-	Idx       int    `json:"idx,omitempty"`
-	Delta     int    `json:"delta,omitempty"`
-	Total     int    `json:"total,omitempty"`
-	Target    int    `json:"target,omitempty"`
-	Name      string `json:"name,omitempty"`
-	Round     int    `json:"round,omitempty"`
-	HostTotal int    `json:"htotal,omitempty"`
-	PeerTotal int    `json:"ptotal,omitempty"`
+	T         string   `json:"t"`
+	Version   int      `json:"v,omitempty"`    // protocol version, in hello and welcome
+	Caps      []string `json:"caps,omitempty"` // capabilities, in hello and welcome
+	Dice      []int    `json:"dice,omitempty"`
+	Keep      []int    `json:"keep,omitempty"`
+	Bank      bool     `json:"bank,omitempty"`
+	Idx       int      `json:"idx,omitempty"`
+	Delta     int      `json:"delta,omitempty"`
+	Turn      int      `json:"turn,omitempty"`  // Idx's pending, unbanked turn points
+	Total     int      `json:"total,omitempty"` // Idx's banked total
+	Target    int      `json:"target,omitempty"`
+	Name      string   `json:"name,omitempty"`
+	Names     []string `json:"names,omitempty"`
+	Round     int      `json:"round,omitempty"`
+	Totals    []int    `json:"totals,omitempty"`
+	Ready     []bool   `json:"ready,omitempty"`
+	Opening   int      `json:"opening,omitempty"`
+	OffBoard  []int    `json:"off,omitempty"`
+	Streaks   []int    `json:"streaks,omitempty"`
+	Penalty   int      `json:"penalty,omitempty"`
+	Final     bool     `json:"final,omitempty"`
+	Watch     bool     `json:"watch,omitempty"`
+	Token     string   `json:"token,omitempty"`
+	ID        string   `json:"id,omitempty"`    // the lobby ID, in the welcome of a paired player
+	Stamp     int64    `json:"stamp,omitempty"` // ping send time, echoed in pong
+	Forfeited []int    `json:"forfeited,omitempty"`
+
+	// Fair dice: hash-chain commitments, and the links revealed for a roll.
+	Fair    bool     `json:"fair,omitempty"`
+	Commit  string   `json:"commit,omitempty"`
+	Link    string   `json:"link,omitempty"`
+	Commits []string `json:"commits,omitempty"`
+	Links   []string `json:"links,omitempty"`
+	Count   int      `json:"count,omitempty"` // rolls made so far, or the roll a link is for
+
+	Standings []Standing `json:"standings,omitempty"`
+	Text      string     `json:"text,omitempty"`
+
+	Rules *ScoringRules `json:"rules,omitempty"`
 }
 
 //MARK: UPnP helper
@@ -58,311 +144,1931 @@ func tryUPnP(localPort uint16) (uint16, bool) {
 	return 0, false
 }
 
-//MARK: Host Lobby
+//MARK: Lobby
 
-func HostLobby(target int) {
-	WinningScore = target
-	hostIP := getOutboundIPv4()
-	externalPort := uint16(9313)
-	if p, ok := tryUPnP(9313); ok {
-		externalPort = p
-		fmt.Println(ColorCyan+"UPnP mapped external port", externalPort, ColorReset)
-	} else {
-		fmt.Println(ColorYellow + "UPnP failed; you may need port‑forward." + ColorReset)
+// remote is one connected player on the host.
+type remote struct {
+	seat  int
+	name  string
+	conn  net.Conn
+	enc   *json.Encoder
+	dec   *json.Decoder
+	ready bool
+	gone  bool
+	watch bool // spectator: receives the stream but never acts
+
+	token   string // session token for reconnecting; in hello, the one presented
+	offline bool   // connection dropped, waiting for a reconnect
+	rtt     time.Duration
+	caps    []string // capabilities agreed with this client
+
+	code  string    // pairing code the host must confirm; "" with the lobby ID
+	asked time.Time // when a paired client asked to be admitted
+}
+
+// inbound is a message, or the read error that ended a connection.
+type inbound struct {
+	r    *remote
+	conn net.Conn // the connection it arrived on, to spot stale errors
+	msg  NetMsg
+	err  error
+}
+
+// read forwards r's messages on conn to inbox until the connection fails,
+// answering pings and timing pongs itself. A connection with nothing to
+// read for pongTimeout fails with os.ErrDeadlineExceeded.
+func (l *lobby) read(r *remote, conn net.Conn, dec *json.Decoder, inbox chan<- inbound) {
+	for {
+		var msg NetMsg
+		conn.SetReadDeadline(time.Now().Add(pongTimeout))
+		if err := dec.Decode(&msg); err != nil {
+			inbox <- inbound{r: r, conn: conn, err: err}
+			return
+		}
+		switch msg.T {
+		case "ping":
+			l.sendTo(r, NetMsg{T: "pong", Stamp: msg.Stamp})
+		case "pong":
+			l.mu.Lock()
+			r.rtt = time.Since(time.Unix(0, msg.Stamp))
+			l.mu.Unlock()
+		default:
+			inbox <- inbound{r: r, conn: conn, msg: msg}
+		}
 	}
-	id := encodeLobbyID(hostIP, externalPort)
-	fmt.Println(ColorYellow+"Lobby created. Share ID: "+id+ColorReset)
+}
 
-	ln, err := net.Listen("tcp", ":9313")
-	if err != nil {
-		fmt.Println(ColorRed+"Listen error:", err, ColorReset)
-		return
+// heartbeat pings every player and spectator until stop is closed.
+func (l *lobby) heartbeat(stop <-chan struct{}) {
+	tick := time.NewTicker(pingInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-tick.C:
+			l.broadcast(NetMsg{T: "ping", Stamp: time.Now().UnixNano()})
+		}
 	}
-	defer ln.Close()
+}
 
-	conn, err := ln.Accept()
-	if err != nil {
-		fmt.Println(ColorRed+"Accept error:", err, ColorReset)
-		return
+func pingText(rtt time.Duration) string {
+	if rtt < time.Millisecond {
+		return "<1 ms"
 	}
-	defer conn.Close()
+	return fmt.Sprintf("%d ms", rtt.Milliseconds())
+}
 
-	enc := json.NewEncoder(conn)
-	dec := json.NewDecoder(conn)
+// timedOut reports whether err came from a read deadline.
+func timedOut(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
 
-	var hello NetMsg
-	if err := dec.Decode(&hello); err != nil || hello.T != "hello" {
-		fmt.Println(ColorRed+"Handshake failed", ColorReset)
+func newToken() string {
+	buf := make([]byte, 16)
+	crand.Read(buf)
+	return fmt.Sprintf("%x", buf)
+}
+
+// lobby is the host's view of every remote player and spectator.
+type lobby struct {
+	name  string // the host's own name
+	inbox chan inbound
+
+	// mu guards the seat list and ready flags, spectators, state and
+	// connections, and orders broadcasts. Only the waiting room changes
+	// remotes, so it may read them without the lock.
+	mu         sync.Mutex
+	remotes    []*remote
+	spectators []*remote
+	welcome    NetMsg
+	state      NetMsg // snapshot of the running game for late spectators
+	started    bool
+	back       chan struct{} // signalled when a dropped player reconnects
+	forfeit    bool          // dropped players forfeit instead of handing over to the AI
+	log        *GameLog      // notes rejected actions; may be nil
+	secret     []byte        // carried by the lobby ID; keys every connection
+	id         string        // the lobby ID, handed to players admitted by pairing
+	lan        bool          // listed on the local network: clients there may pair
+	open       int           // free seats, as advertised on the local network
+	dropped    []droppedSeat // players unseated mid-roll; only the game loop touches it
+}
+
+// droppedSeat is a player unseated during a fair-dice draw, and why.
+type droppedSeat struct {
+	r   *remote
+	why string
+}
+
+// sendTo writes one message to a single remote.
+func (l *lobby) sendTo(r *remote, msg NetMsg) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r.enc.Encode(msg)
+}
+
+func (l *lobby) broadcast(msg NetMsg) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.send(msg)
+}
+
+func (l *lobby) send(msg NetMsg) {
+	for _, r := range l.remotes {
+		if !r.gone && !r.offline {
+			r.enc.Encode(msg)
+		}
+	}
+	for _, r := range l.spectators {
+		r.enc.Encode(msg)
+	}
+}
+
+// Record implements Recorder: every engine event goes to every remote.
+func (l *lobby) Record(g *Game, events []Event) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, ev := range events {
+		if msg, ok := eventMsg(g, ev); ok {
+			l.send(msg)
+		}
+	}
+	l.state = snapshotMsg(g)
+}
+
+// sync refreshes the snapshot sent to late spectators.
+func (l *lobby) sync(g *Game) {
+	l.mu.Lock()
+	l.state = snapshotMsg(g)
+	l.mu.Unlock()
+}
+
+// watch admits a spectator, catching them up on a game in progress.
+func (l *lobby) watch(r *remote) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.spectators) >= maxSpectators {
+		r.enc.Encode(NetMsg{T: "notice", Text: "Too many spectators already."})
+		r.conn.Close()
 		return
 	}
-	enc.Encode(NetMsg{T: "welcome", Idx: 1, Target: WinningScore})
+	if !ValidProfileName(r.name) {
+		r.name = fmt.Sprintf("Spectator %d", len(l.spectators)+1)
+	}
+	r.enc.Encode(l.welcomeFor(r))
+	if l.started {
+		r.enc.Encode(l.state)
+	} else {
+		r.enc.Encode(l.lobbyMsg())
+	}
+	l.spectators = append(l.spectators, r)
+	fmt.Println(ColorCyan + r.name + " is watching." + ColorReset)
+	go func() {
+		// Spectators only answer pings; anything else is ignored.
+		in := make(chan inbound, 1)
+		go l.read(r, r.conn, r.dec, in)
+		for x := range in {
+			if x.err != nil {
+				l.unwatch(r)
+				return
+			}
+		}
+	}()
+}
 
-	hostTotal, peerTotal := 0, 0
-	currentIdx := 0
-	diceToRoll := 6
-	encHot := make(chan NetMsg, 2)
-	go func() { for m := range encHot { enc.Encode(m) } }()
-	round := 1
+func (l *lobby) unwatch(r *remote) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, x := range l.spectators {
+		if x == r {
+			l.spectators = append(l.spectators[:i], l.spectators[i+1:]...)
+			fmt.Println(ColorCyan + r.name + " stopped watching." + ColorReset)
+		}
+	}
+	r.conn.Close()
+}
 
-	for {
-		if currentIdx == 0 && diceToRoll == 6 {
-			fmt.Printf("\n========================\n")
-			fmt.Printf(" ROUND %d – First to %d\n", round, WinningScore)
-			fmt.Printf("========================\n")
-			fmt.Printf("Scoreboard → %sYou%s: %d | %sPeer%s: %d\n", ColorGreen, ColorReset, hostTotal, ColorRed, ColorReset, peerTotal)
-			enc.Encode(NetMsg{T: "banner", Round: round, HostTotal: hostTotal, PeerTotal: peerTotal, Target: WinningScore})
-			round++
-			fmt.Println("\n" + ColorGreen + "Your turn:" + ColorReset)
-			fmt.Println(ColorYellow + "First roll will happen automatically; then choose dice to keep or bank." + ColorReset)
+// printPing shows the latest round-trip time to every connected player.
+func (l *lobby) printPing() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var pings []string
+	for _, r := range l.remotes {
+		if !r.gone && r.rtt > 0 {
+			pings = append(pings, r.name+" "+pingText(r.rtt))
 		}
+	}
+	if len(pings) > 0 {
+		fmt.Println(ColorCyan + "Ping → " + strings.Join(pings, " | ") + ColorReset)
+	}
+}
 
-		roll := rollDice(diceToRoll)
-		enc.Encode(NetMsg{T: "roll", Dice: roll, Idx: currentIdx})
-		if currentIdx == 0 {
-			renderDice(roll)
-		} else {
-			renderPeerDice(roll)
+func (l *lobby) spectatorNames() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var names []string
+	for _, r := range l.spectators {
+		names = append(names, r.name)
+	}
+	return names
+}
+
+func (l *lobby) names() []string {
+	names := []string{l.name}
+	for _, r := range l.remotes {
+		names = append(names, r.name)
+	}
+	return names
+}
+
+// uniqueName keeps a joining player's name unless it is invalid or taken.
+func (l *lobby) uniqueName(name string) string {
+	taken := !ValidProfileName(name)
+	for _, n := range l.names() {
+		taken = taken || strings.EqualFold(n, name)
+	}
+	if taken {
+		return fmt.Sprintf("Player %d", len(l.remotes)+2)
+	}
+	return name
+}
+
+// sendLobby tells every remote who is in the waiting room.
+func (l *lobby) sendLobby() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.open = maxRemotes - len(l.remotes)
+	l.send(l.lobbyMsg())
+}
+
+func (l *lobby) lobbyMsg() NetMsg {
+	ready := []bool{true}
+	for _, r := range l.remotes {
+		ready = append(ready, r.ready)
+	}
+	return NetMsg{T: "lobby", Names: l.names(), Ready: ready}
+}
+
+func (l *lobby) printLobby() {
+	fmt.Printf(ColorCyan+"Lobby (%d/%d remote players):"+ColorReset+"\n", len(l.remotes), maxRemotes)
+	fmt.Println("  " + l.name + " (host)")
+	for _, r := range l.remotes {
+		state := ColorYellow + "not ready" + ColorReset
+		if r.ready {
+			state = ColorGreen + "ready" + ColorReset
+		}
+		fmt.Printf("  %s – %s\n", r.name, state)
+	}
+	if names := l.spectatorNames(); len(names) > 0 {
+		fmt.Println("  Spectators: " + strings.Join(names, ", "))
+	}
+}
+
+func (l *lobby) drop(r *remote) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r.conn.Close()
+	for i, x := range l.remotes {
+		if x == r {
+			l.remotes = append(l.remotes[:i], l.remotes[i+1:]...)
+			return
 		}
+	}
+}
 
-		if calculateScore(roll) == 0 {
-			enc.Encode(NetMsg{T: "farkle", Idx: currentIdx})
-			if currentIdx == 0 {
-				fmt.Println(ColorRed + "Farkle! You scored 0 this turn." + ColorReset)
-			}
-			diceToRoll = 6
-			currentIdx = 1 - currentIdx
+func (l *lobby) close(text string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, r := range append(l.remotes, l.spectators...) {
+		if !r.gone && text != "" {
+			r.enc.Encode(NetMsg{T: "notice", Text: text})
+		}
+		r.conn.Close()
+	}
+	l.spectators = nil
+}
+
+// rejoin swaps a reconnecting player's new connection into their seat and
+// resyncs them. It reports false if nobody holds the presented token.
+func (l *lobby) rejoin(nr *remote) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, r := range l.remotes {
+		if r.token != nr.token {
 			continue
 		}
+		if r.gone {
+			text := "Your seat has been handed to the computer."
+			if l.forfeit {
+				text = "You have forfeited this game."
+			}
+			nr.enc.Encode(NetMsg{T: "notice", Text: text})
+			nr.conn.Close()
+			return true
+		}
+		r.conn.Close()
+		r.conn, r.enc, r.dec, r.offline, r.caps = nr.conn, nr.enc, nr.dec, false, nr.caps
+		r.enc.Encode(l.welcomeFor(r))
+		r.enc.Encode(l.state)
+		go l.read(r, r.conn, r.dec, l.inbox)
+		fmt.Println(ColorGreen + r.name + " reconnected." + ColorReset)
+		select {
+		case l.back <- struct{}{}:
+		default:
+		}
+		return true
+	}
+	return false
+}
+
+// lost pauses the game while a player whose connection dropped or timed
+// out has reconnectGrace to come back; after that the lobby's drop policy
+// applies.
+func (l *lobby) lost(g *Game, in inbound) {
+	if !l.waitReturn(in) {
+		abandon(g, l, in.r, in.r.name+" did not come back")
+	}
+}
+
+// waitReturn pauses the game for up to reconnectGrace while the player
+// whose connection failed with in reconnects, and reports false if they do
+// not. Errors from a connection that has since been replaced are ignored.
+func (l *lobby) waitReturn(in inbound) bool {
+	r := in.r
+	l.mu.Lock()
+	stale := r.gone || in.conn != r.conn
+	if !stale {
+		r.offline = true
+	}
+	l.mu.Unlock()
+	if stale {
+		return true
+	}
+
+	why := r.name + " lost connection"
+	if timedOut(in.err) {
+		why = fmt.Sprintf("%s stopped responding (no reply for %.0f s)", r.name, pongTimeout.Seconds())
+	}
+	text := fmt.Sprintf("%s; the game is paused for up to %.0f s while they reconnect.", why, reconnectGrace.Seconds())
+	fmt.Println(ColorYellow + text + ColorReset)
+	l.broadcast(NetMsg{T: "notice", Text: text})
+	timeout := time.After(reconnectGrace)
+	for {
+		select {
+		case <-l.back:
+			l.mu.Lock()
+			offline := r.offline
+			l.mu.Unlock()
+			if !offline {
+				l.broadcast(NetMsg{T: "notice", Text: r.name + " is back; the game continues."})
+				return true
+			}
+		case <-timeout:
+			return false
+		}
+	}
+}
+
+// welcomeFor is the welcome message for one client: the lobby settings
+// plus its agreed capabilities and session token, and for a paired client
+// the lobby ID it reconnects with.
+func (l *lobby) welcomeFor(r *remote) NetMsg {
+	msg := l.welcome
+	msg.Caps, msg.Token = r.caps, r.token
+	if r.code != "" {
+		msg.ID = l.id
+	}
+	return msg
+}
+
+// negotiate checks a client's hello against the lobby and returns the
+// capabilities both sides support, or why the client cannot join.
+func (l *lobby) negotiate(hello NetMsg) ([]string, error) {
+	if hello.Version != protocolVersion {
+		if hello.Version == 0 {
+			return nil, fmt.Errorf("this lobby speaks protocol v%d and your client predates versioning; please update", protocolVersion)
+		}
+		return nil, fmt.Errorf("this lobby speaks protocol v%d but your client speaks v%d; please use the same release", protocolVersion, hello.Version)
+	}
+	var caps []string
+	for _, c := range supportedCaps {
+		if slices.Contains(hello.Caps, c) {
+			caps = append(caps, c)
+		}
+	}
+	need := []string{capHeartbeat, capSecure}
+	if l.welcome.Rules != nil && l.welcome.Rules != ClassicRules {
+		need = append(need, capRules)
+	}
+	if l.welcome.Fair {
+		need = append(need, capFair)
+	}
+	if hello.Watch {
+		need = append(need, capSpectate)
+	}
+	var missing []string
+	for _, c := range need {
+		if !slices.Contains(caps, c) {
+			missing = append(missing, capNames[c])
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("this lobby needs %s, which your client does not support", strings.Join(missing, ", "))
+	}
+	return caps, nil
+}
 
-		if currentIdx == 0 {
-			turnScore, diceRemaining, ended := hostTurnLoop(roll, diceToRoll, encHot)
-			hostTotal += turnScore
-			enc.Encode(NetMsg{T: "score", Idx: 0, Delta: turnScore, Total: hostTotal})
-			if hostTotal >= WinningScore {
-				enc.Encode(NetMsg{T: "game_over", Idx: 0})
-				fmt.Println(ColorGreen + "You win! Returning to menu." + ColorReset)
+// acceptLoop handshakes every incoming connection and hands it to joins
+// until stop is closed. Connections that cannot prove they hold the lobby
+// secret, or pair from the local network of a listed lobby, are dropped
+// before any message is read; clients whose protocol
+// version or capabilities do not fit, including older clients that send
+// their hello in the clear, are sent a reject message explaining why.
+func (l *lobby) acceptLoop(ln net.Listener, joins chan<- *remote, stop <-chan struct{}) {
+	for {
+		raw, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			ua, _ := raw.RemoteAddr().(*net.TCPAddr)
+			conn, code, err := serverHandshake(raw, l.secret, l.lan && ua != nil && onLocalSubnet(ua.IP))
+			if errors.Is(err, ErrPlaintext) {
+				l.rejectPlain(raw)
 				return
 			}
-			diceToRoll = diceRemaining
-			if !ended {
-				continue
+			if err != nil {
+				if errors.Is(err, ErrAuth) {
+					fmt.Println(ColorYellow + "Turned away a connection that failed authentication." + ColorReset)
+				}
+				raw.Close()
+				return
 			}
-		} else {
-			enc.Encode(NetMsg{T: "your_turn"})
-			var act NetMsg
-			if err := dec.Decode(&act); err != nil || act.T != "action" {
-				fmt.Println(ColorRed + "Peer disconnected." + ColorReset)
+			r := &remote{conn: conn, enc: json.NewEncoder(conn), dec: json.NewDecoder(conn)}
+			var hello NetMsg
+			conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+			if err := r.dec.Decode(&hello); err != nil || hello.T != "hello" {
+				conn.Close()
 				return
 			}
-			score := calculateScore(act.Keep)
-			if score == 0 {
-				enc.Encode(NetMsg{T: "farkle", Idx: 1})
-				diceToRoll = 6
-				fmt.Println(ColorRed + "Peer Farkled!" + ColorReset)
-			} else {
-				peerTotal += score
-				enc.Encode(NetMsg{T: "score", Idx: 1, Delta: score, Total: peerTotal})
-				if peerTotal >= WinningScore {
-					enc.Encode(NetMsg{T: "game_over", Idx: 1})
-					fmt.Println(ColorRed + "Peer wins. Returning to menu." + ColorReset)
-					return
-				}
-				if act.Bank {
-					diceToRoll = 6
-				} else {
-					if len(act.Keep) == diceToRoll {
-						diceToRoll = 6
-						encHot <- NetMsg{T: "hot", Idx: 1}
-					} else {
-						diceToRoll -= len(act.Keep)
-					}
-					continue
-				}
+			conn.SetReadDeadline(time.Time{})
+			caps, err := l.negotiate(hello)
+			if err != nil {
+				r.enc.Encode(NetMsg{T: "reject", Version: protocolVersion, Text: capitalize(err.Error()) + "."})
+				conn.Close()
+				fmt.Println(ColorYellow + "Turned away a client: " + err.Error() + "." + ColorReset)
+				return
 			}
-		}
-		currentIdx = 1 - currentIdx
+			r.name, r.watch, r.token, r.caps = hello.Name, hello.Watch, hello.Token, caps
+			r.code, r.asked = code, time.Now()
+			select {
+			case joins <- r:
+			case <-stop:
+				conn.Close()
+			}
+		}()
 	}
 }
 
-//MARK: Host Turn Loop
-func hostTurnLoop(roll []int, diceToRoll int, encHot chan NetMsg) (turnScore int, diceRemaining int, turnEnded bool) {
-	if calculateScore(roll) == 0 {
-		fmt.Println(ColorRed + "Farkle! You scored 0 this turn." + ColorReset)
-		encHot <- NetMsg{T: "farkle", Idx: 0}
-		return 0, 6, true
-	}
-	promptText := ColorBlue + "Commands: 'keep X X...' (score & continue), 'bank X X...' (score & pass), or 'quit'" + ColorReset
-	for {
-		fmt.Println(promptText)
-		kept, action := promptAction(roll)
-		switch action {
-		case "quit":
-			fmt.Println("Goodbye!")
-			os.Exit(0)
-		case "keep":
-			score := calculateScore(kept)
-			turnScore += score
-			fmt.Printf(ColorGreen+"Scored %d (turn total %d)."+ColorReset+"\n", score, turnScore)
-			if len(kept) == diceToRoll {
-				fmt.Println(ColorYellow + "Hot dice!" + ColorReset)
-				encHot <- NetMsg{T: "hot", Idx: 0}
-				newRoll := rollDice(6)
-				renderDice(newRoll)
-				encHot <- NetMsg{T: "roll", Dice: newRoll, Idx: 0}
-				returnScore, newRemaining, _ := hostTurnLoop(newRoll, 6, encHot)
-				return turnScore + returnScore, newRemaining, false
-			}
-			returnScore := turnScore
-			newDice := diceToRoll - len(kept)
-			newRoll := rollDice(newDice)
-			renderDice(newRoll)
-			encHot <- NetMsg{T: "roll", Dice: newRoll, Idx: 0}
-			returnScore2, newRemaining, _ := hostTurnLoop(newRoll, newDice, encHot)
-			return returnScore + returnScore2, newRemaining, false
-		case "bank":
-			score := calculateScore(kept)
-			turnScore += score
-			fmt.Printf(ColorGreen+"Banking %d (turn total %d)."+ColorReset+"\n", score, turnScore)
-			return turnScore, 6, true
-		}
+// rejectPlain answers a client that sent its hello in the clear, after
+// serverHandshake consumed the opening brace, with a plain JSON reject.
+// Nothing it announces counts as capSecure, since it skipped the handshake.
+func (l *lobby) rejectPlain(conn net.Conn) {
+	defer conn.Close()
+	var hello NetMsg
+	conn.SetReadDeadline(time.Now().Add(handshakeLimit))
+	dec := json.NewDecoder(io.MultiReader(strings.NewReader("{"), conn))
+	if err := dec.Decode(&hello); err != nil || hello.T != "hello" {
+		return
 	}
+	hello.Caps = slices.DeleteFunc(hello.Caps, func(c string) bool { return c == capSecure })
+	_, err := l.negotiate(hello)
+	json.NewEncoder(conn).Encode(NetMsg{T: "reject", Version: protocolVersion, Text: capitalize(err.Error()) + "."})
+	fmt.Println(ColorYellow + "Turned away a client: " + err.Error() + "." + ColorReset)
 }
 
-//MARK: Peer Lobby
-func JoinLobby(hostIP, lobbyID string) {
-	port := uint16(9313)
+//MARK: Host Lobby
+
+// HostOptions configure the host side of a networked game.
+type HostOptions struct {
+	Name    string   // profile name ("" for "Host")
+	Forfeit bool     // players who drop out forfeit rather than hand their seat to the AI
+	Log     *GameLog // also records rejected actions
+	Fair    bool     // draw every roll from hash-chain links every client can check
+	Address string   // IP or hostname put in the lobby ID; "" picks this machine's
+	LAN     bool     // answer 'lobbies' queries from the local network (the ID stays private)
+}
 
-	if hostIP == "" {
-		if ip, prt, ok := decodeIPFromLobby(lobbyID); ok {
-			hostIP = ip
-			port = prt
+// HostLobby opens a lobby for up to maxRemotes players, runs the waiting
+// room until the host starts the game, then hosts it.
+func HostLobby(opts Options, ho HostOptions) {
+	name := ho.Name
+	if name == "" {
+		name = "Host"
+	}
+	host := ho.Address
+	if host == "" {
+		host = getOutboundIP()
+	}
+	externalPort := uint16(9313)
+	// UPnP maps IPv4 ports only; an IPv6 host is reached directly.
+	if ip := net.ParseIP(host); ip == nil || ip.To4() != nil {
+		if p, ok := tryUPnP(9313); ok {
+			externalPort = p
+			fmt.Println(ColorCyan+"UPnP mapped external port", externalPort, ColorReset)
 		} else {
-			fmt.Println(ColorRed + "Invalid lobby ID format." + ColorReset)
-			return
+			fmt.Println(ColorYellow + "UPnP failed; you may need port‑forward." + ColorReset)
 		}
 	}
-	addr := net.JoinHostPort(hostIP, fmt.Sprint(port))
-	fmt.Println("Dialling", addr, "with lobby ID", lobbyID, "…")
-
-	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	secret := newLobbySecret()
+	id, err := encodeLobbyID(host, externalPort, secret)
 	if err != nil {
-		fmt.Println(ColorRed+"Connection failed:", err, ColorReset)
+		fmt.Println(ColorRed + "Cannot advertise the lobby: " + err.Error() + ColorReset)
 		return
 	}
-	defer conn.Close()
+	fmt.Println(ColorYellow+"Lobby created. Share ID: "+id+ColorReset, "("+net.JoinHostPort(host, fmt.Sprint(externalPort))+")")
 
-	enc := json.NewEncoder(conn)
-	dec := json.NewDecoder(conn)
-
-	enc.Encode(NetMsg{T: "hello", Name: "peer"})
-	var welcome NetMsg
-	if err := dec.Decode(&welcome); err != nil || welcome.T != "welcome" {
-		fmt.Println(ColorRed + "Handshake failed." + ColorReset)
+	ln, err := net.Listen("tcp", ":9313")
+	if err != nil {
+		fmt.Println(ColorRed+"Listen error:", err, ColorReset)
 		return
 	}
-	WinningScore = welcome.Target
-	fmt.Println(ColorGreen+"Connected! Target score:", WinningScore, ColorReset)
+	defer ln.Close()
 
-	var mu sync.Mutex
-	var lastRoll []int
+	l := &lobby{name: name, inbox: make(chan inbound, 64), back: make(chan struct{}, 1), forfeit: ho.Forfeit, log: ho.Log, secret: secret, id: id, lan: ho.LAN, open: maxRemotes}
+	l.welcome = NetMsg{T: "welcome", Version: protocolVersion, Name: name, Target: opts.Target, Rules: opts.Rules, Opening: opts.OpeningScore, Penalty: opts.FarklePenalty, Final: opts.FinalRound, Fair: ho.Fair}
+	joins := make(chan *remote)
+	stop := make(chan struct{})
+	defer close(stop)
+	go l.acceptLoop(ln, joins, stop)
+	go l.heartbeat(stop)
+	if ho.LAN {
+		go l.advertise(ln.Addr().(*net.TCPAddr).Port, stop)
+	}
+	if !waitingRoom(l, joins) {
+		l.close("The host closed the lobby.")
+		return
+	}
+	defer l.close("")
 
-	for {
-		var msg NetMsg
-		if err := dec.Decode(&msg); err != nil {
-			fmt.Println(ColorRed + "Connection lost." + ColorReset)
-			return
+	players := []Player{{Name: name}}
+	for i, r := range l.remotes {
+		r.seat = i + 1
+		players = append(players, Player{Name: r.name})
+	}
+	if ho.Fair && l.log == nil {
+		if l.log = transcriptLog(); l.log != nil {
+			defer l.log.Close()
+			opts.Recorder = Recorders(opts.Recorder, l.log)
 		}
+	}
+	opts.Recorder = Recorders(opts.Recorder, l)
+	g := NewGame(opts, players...)
+	l.mu.Lock()
+	for _, r := range l.remotes {
+		r.enc.Encode(NetMsg{T: "start", Idx: r.seat, Names: l.names()})
+	}
+	for _, r := range l.spectators {
+		r.enc.Encode(NetMsg{T: "start", Idx: -1, Names: l.names()})
+	}
+	l.started, l.state = true, snapshotMsg(g)
+	l.mu.Unlock()
 
-		switch msg.T {
-		case "roll":
-			renderDice(msg.Dice)
-			lastRoll = msg.Dice
-		case "your_turn":
-			mu.Lock()
-			turnLoopPeer(enc, lastRoll)
-			mu.Unlock()
-		case "farkle":
-			if msg.Idx == 0 {
-				fmt.Println(ColorRed + "Host Farkled." + ColorReset)
-			} else {
-				fmt.Println(ColorRed + "You Farkled." + ColorReset)
+	// Once the game is under way, new players are turned away; spectators
+	// are caught up and join the stream, and dropped players with a session
+	// token take back their seat. Nobody is admitted by pairing any more,
+	// as the host is busy playing. This ends with the game.
+	go func() {
+		for {
+			var r *remote
+			select {
+			case r = <-joins:
+			case <-stop:
+				return
 			}
-		case "score":
-			if msg.Idx == 0 {
-				fmt.Printf(ColorYellow+"Host scored %d (total %d)"+ColorReset+"\n", msg.Delta, msg.Total)
-			} else {
-				fmt.Printf(ColorGreen+"You scored %d (total %d)"+ColorReset+"\n", msg.Delta, msg.Total)
+			if r.code != "" {
+				r.enc.Encode(NetMsg{T: "notice", Text: "That game has already started; ask the host for the lobby ID to watch it."})
+				r.conn.Close()
+				continue
 			}
-		case "game_over":
-			if msg.Idx == 1 {
-				fmt.Println(ColorGreen + "🏆 You win! Returning to menu." + ColorReset)
-			} else {
-				fmt.Println(ColorRed + "💀 Host wins. Returning to menu." + ColorReset)
+			if r.watch {
+				l.watch(r)
+				continue
 			}
-			return
-		case "hot":
-			if msg.Idx == 0 {
-				fmt.Println(ColorYellow + "Host got hot dice!" + ColorReset)
-			} else {
-				fmt.Println(ColorYellow + "Hot dice! Rolling all 6 again..." + ColorReset)
+			if r.token != "" && l.rejoin(r) {
+				continue
 			}
-		case "banner":
-			fmt.Printf("\n========================\n")
-			fmt.Printf(" ROUND %d – First to %d\n", msg.Round, msg.Target)
-			fmt.Printf("========================\n")
-			fmt.Printf("Scoreboard → %sHost%s: %d | %sYou%s: %d\n", ColorYellow, ColorReset, msg.HostTotal, ColorGreen, ColorReset, msg.PeerTotal)
-			fmt.Println("\n" + ColorRed + "Host turn:" + ColorReset)
+			r.enc.Encode(NetMsg{T: "notice", Text: "That game has already started; join with --watch to spectate."})
+			r.conn.Close()
+		}
+	}()
+	if ho.Fair {
+		l.log.Start(l.names(), l.welcome)
+		fd, err := l.agreeDice(g)
+		if err != nil {
+			text := "Fair dice setup failed: " + err.Error() + "."
+			fmt.Println(ColorRed + text + ColorReset)
+			l.broadcast(NetMsg{T: "notice", Text: text})
+			return
 		}
+		g.Dice = fd
+		fmt.Println(ColorGreen + "Fair dice agreed: every roll is drawn from links all players reveal for it." + ColorReset)
 	}
-}
+	if g.FinalRound {
+		fmt.Println(ColorBlue + "Final round: reaching the target gives everyone else one more turn." + ColorReset)
+	}
+	hostGame(g, l)
 
-func turnLoopPeer(enc *json.Encoder, roll []int) {
-	promptText := ColorBlue + "Commands: 'keep X X...' (score & continue), 'bank X X...' (score & pass), or 'quit'" + ColorReset
-	for {
-		fmt.Println(promptText)
-		kept, action := promptAction(roll)
-		switch action {
-		case "quit":
-			fmt.Println("Goodbye!")
-			os.Exit(0)
-		case "keep":
-			enc.Encode(NetMsg{T: "action", Keep: kept, Bank: false})
-			return
-		case "bank":
-			enc.Encode(NetMsg{T: "action", Keep: kept, Bank: true})
-			return
+	printStandings(g.Standings())
+	if g.Winner == 0 {
+		fmt.Println(ColorGreen + "You win! Returning to menu." + ColorReset)
+	} else {
+		fmt.Println(ColorRed + g.Players[g.Winner].Name + " wins. Returning to menu." + ColorReset)
+	}
+	if fd, ok := g.Dice.(*FairDice); ok {
+		fmt.Printf(ColorGreen+"Fair dice: %d rolls drawn from the links every player revealed."+ColorReset+"\n", fd.Count)
+		if path := l.log.Path(); path != "" {
+			fmt.Println("Transcript: " + path + " – check it with 'verify " + path + "'.")
 		}
 	}
 }
 
-//------------------------------------------------------------
-func generateLobbyID() string {
-	buf := make([]byte, 5)
-	crand.Read(buf)
-	return strings.ToUpper(b32.EncodeToString(buf))
+// agreeDice collects every player's fair-dice commitment, the host's
+// included, and publishes them before the first roll. Nothing secret is
+// revealed yet: each roll then asks every player for its link (drawLinks).
+func (l *lobby) agreeDice(g *Game) (*FairDice, error) {
+	own := NewFairChain()
+	commits := make([]string, len(l.remotes)+1)
+	commits[0] = own.Commit()
+	fmt.Println(ColorBlue + "Agreeing on fair dice…" + ColorReset)
+
+	l.broadcast(NetMsg{T: "fair"})
+	err := l.collect("commit", func(r *remote, msg NetMsg) error {
+		if len(msg.Commit) != 64 {
+			return fmt.Errorf("%s sent a malformed commitment", r.name)
+		}
+		commits[r.seat] = msg.Commit
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	fd, err := NewFairDice(commits, own)
+	if err != nil {
+		return nil, err
+	}
+	fd.Gather = func(n int) []string { return l.drawLinks(g, fd, n) }
+	msg := NetMsg{T: "commits", Commits: commits}
+	l.broadcast(msg)
+	l.log.Message(msg)
+	return fd, nil
 }
 
-// encodeLobbyID packs IPv4(4B)+Port(2B)+rand(1B) → 7 bytes → Base32
-func encodeLobbyID(hostIP string, port uint16) string {
-	ip := net.ParseIP(hostIP).To4()
-	if ip == nil {
-		return generateLobbyID()
+// drawLinks asks every seated player for their link for roll n and returns
+// the links in seat order, the host's left empty. Who takes part is fixed
+// before anyone reveals: only players gone for good are left out. A player
+// who drops mid-draw is waited for and asked again, so the host cannot drop
+// a link it has seen and dislikes; one who sends a link that does not
+// follow their commitment, or none in time, is unseated and handed to the
+// drop policy once the roll is made.
+func (l *lobby) drawLinks(g *Game, fd *FairDice, n int) []string {
+	links := make([]string, len(fd.Commits))
+	ask := NetMsg{T: "draw", Count: n}
+	want := map[*remote]bool{}
+	for _, r := range l.remotes {
+		if !r.gone {
+			want[r] = true
+			l.sendTo(r, ask)
+		}
+	}
+	timeout := time.After(pongTimeout)
+	for len(want) > 0 {
+		select {
+		case in := <-l.inbox:
+			r := in.r
+			switch {
+			case in.err != nil:
+				if !l.waitReturn(in) {
+					l.unseatMidRoll(r, r.name+" did not come back")
+					delete(want, r)
+				} else if want[r] {
+					l.sendTo(r, ask)
+				}
+				timeout = time.After(pongTimeout)
+			case in.msg.T == "leave":
+				l.unseatMidRoll(r, r.name+" left the game")
+				delete(want, r)
+			case in.msg.T == "link" && want[r] && in.msg.Count == n:
+				if fd.follows(r.seat, in.msg.Link, n) {
+					links[r.seat] = in.msg.Link
+				} else {
+					l.unseatMidRoll(r, r.name+" revealed a fair-dice link that does not match their commitment")
+				}
+				delete(want, r)
+			}
+		case <-timeout:
+			for r := range want {
+				l.unseatMidRoll(r, r.name+" did not reveal their fair-dice link in time")
+			}
+			return links
+		}
 	}
-	buf := make([]byte, 7)
-	copy(buf, ip)
-	binary.BigEndian.PutUint16(buf[4:6], port)
-	crand.Read(buf[6:7])
-	return strings.ToUpper(b32.EncodeToString(buf))
+	return links
 }
 
-func decodeIPFromLobby(id string) (string, uint16, bool) {
-	data, err := b32.DecodeString(strings.ToUpper(id))
-	if err != nil || len(data) != 7 {
-		return "", 0, false
+// collect waits for one typ message from every remote player.
+func (l *lobby) collect(typ string, take func(*remote, NetMsg) error) error {
+	got := map[*remote]bool{}
+	timeout := time.After(pongTimeout)
+	for len(got) < len(l.remotes) {
+		select {
+		case in := <-l.inbox:
+			switch {
+			case in.err != nil:
+				return fmt.Errorf("%s disconnected", in.r.name)
+			case in.msg.T == typ && !got[in.r]:
+				if err := take(in.r, in.msg); err != nil {
+					return err
+				}
+				got[in.r] = true
+			}
+		case <-timeout:
+			return errors.New("not every player answered in time")
+		}
 	}
-	ip := net.IPv4(data[0], data[1], data[2], data[3]).String()
-	port := binary.BigEndian.Uint16(data[4:6])
-	return ip, port, true
+	return nil
+}
+
+// transcriptLog opens a log for a fair-dice game played without --log, so
+// there is always a transcript to verify.
+func transcriptLog() *GameLog {
+	path := fmt.Sprintf("farkle-fair-%s.jsonl", time.Now().Format("20060102-150405.000"))
+	log, err := CreateLog(path)
+	if err != nil {
+		fmt.Println(ColorYellow + "Cannot write a fair-dice transcript: " + err.Error() + ColorReset)
+		return nil
+	}
+	fmt.Println(ColorBlue + "Recording the fair-dice transcript to " + path + "." + ColorReset)
+	return log
+}
+
+// waitingRoom admits players until the host types 'start' with everyone
+// ready. Players who paired on the local network wait until the host types
+// the code on their screen. It reports false if the host gave up.
+func waitingRoom(l *lobby, joins <-chan *remote) bool {
+	fmt.Println(ColorBlue + "Waiting for players… type 'start' once everyone is ready, 'list' to see the lobby, or 'quit'." + ColorReset)
+	var pairing []*remote // paired clients waiting to be admitted
+	defer func() {
+		for _, r := range pairing {
+			r.enc.Encode(NetMsg{T: "notice", Text: "The host did not admit you before the lobby closed or the game started."})
+			r.conn.Close()
+		}
+	}()
+	for {
+		select {
+		case r := <-joins:
+			if r.code != "" {
+				pairing = append(pairing, r)
+				who, as := r.name, "join"
+				if !ValidProfileName(who) {
+					who = "A player"
+				}
+				if r.watch {
+					as = "watch"
+				}
+				fmt.Printf(ColorCyan+"%s (%s) asks to %s from the local network. If their screen shows code %s, type 'admit %s'."+ColorReset+"\n", who, remoteHost(r.conn), as, r.code, r.code)
+				continue
+			}
+			l.admit(r)
+
+		case in := <-l.inbox:
+			switch {
+			case in.err != nil && timedOut(in.err):
+				fmt.Println(ColorYellow + in.r.name + " stopped responding and was removed from the lobby." + ColorReset)
+				l.drop(in.r)
+				l.sendLobby()
+			case in.err != nil:
+				fmt.Println(ColorYellow + in.r.name + " left the lobby." + ColorReset)
+				l.drop(in.r)
+				l.sendLobby()
+			case in.msg.T == "ready" && !in.r.ready:
+				l.mu.Lock()
+				in.r.ready = true
+				l.mu.Unlock()
+				fmt.Println(ColorGreen + in.r.name + " is ready." + ColorReset)
+				l.sendLobby()
+			}
+
+		case line, ok := <-Lines():
+			if !ok {
+				return false
+			}
+			switch cmd := strings.ToLower(strings.TrimSpace(line)); cmd {
+			case "start":
+				if len(l.remotes) == 0 {
+					fmt.Println("Nobody has joined yet.")
+					continue
+				}
+				var waiting []string
+				for _, r := range l.remotes {
+					if !r.ready {
+						waiting = append(waiting, r.name)
+					}
+				}
+				if len(waiting) > 0 {
+					fmt.Println("Still waiting for: " + strings.Join(waiting, ", "))
+					continue
+				}
+				return true
+			case "list":
+				l.printLobby()
+			case "quit", "exit":
+				return false
+			case "":
+			default:
+				if code, ok := strings.CutPrefix(cmd, "admit "); ok {
+					pairing = l.admitCode(pairing, strings.TrimSpace(code))
+					continue
+				}
+				fmt.Println(ColorBlue + "Lobby commands: 'start', 'list', 'admit <code>' or 'quit'." + ColorReset)
+			}
+		}
+	}
+}
+
+// admit seats a joining player, or adds a spectator, and welcomes them.
+func (l *lobby) admit(r *remote) {
+	if r.watch {
+		l.watch(r)
+		return
+	}
+	if len(l.remotes) >= maxRemotes {
+		r.enc.Encode(NetMsg{T: "notice", Text: "The lobby is full."})
+		r.conn.Close()
+		return
+	}
+	r.name, r.token = l.uniqueName(r.name), ""
+	if slices.Contains(r.caps, capReconnect) {
+		r.token = newToken()
+	}
+	r.enc.Encode(l.welcomeFor(r))
+	l.mu.Lock()
+	l.remotes = append(l.remotes, r)
+	l.mu.Unlock()
+	go l.read(r, r.conn, r.dec, l.inbox)
+	fmt.Printf(ColorGreen+"%s joined (%d/%d)."+ColorReset+"\n", r.name, len(l.remotes), maxRemotes)
+	l.sendLobby()
+}
+
+// admitCode admits the paired client showing code and returns the clients
+// still waiting. Requests older than pairWait have given up and are dropped.
+func (l *lobby) admitCode(pairing []*remote, code string) []*remote {
+	var found *remote
+	pairing = slices.DeleteFunc(pairing, func(r *remote) bool {
+		switch {
+		case time.Since(r.asked) > pairWait:
+			r.conn.Close()
+			return true
+		case found == nil && r.code == code:
+			found = r
+			return true
+		}
+		return false
+	})
+	if found == nil {
+		fmt.Println(ColorYellow + "Nobody is waiting with code " + code + "; ask them to pick the lobby again." + ColorReset)
+		return pairing
+	}
+	l.admit(found)
+	return pairing
+}
+
+// remoteHost is the address a connection came from, without the port.
+func remoteHost(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// hostGame plays g to the end: the host's own turns at this terminal,
+// remote turns over the network and abandoned seats by the computer.
+func hostGame(g *Game, l *lobby) {
+	lastChance := false
+	for !g.Over {
+		if l.settle(g); g.Over {
+			break
+		}
+		announceLastChance(g, &lastChance)
+		t := g.Turn
+		fresh := t.DiceLeft == 6 && t.Score == 0 && t.Roll == nil
+		if fresh && t.Idx == 0 {
+			printBanner(g)
+			l.printPing()
+			if names := l.spectatorNames(); len(names) > 0 {
+				fmt.Println(ColorCyan + "Watching: " + strings.Join(names, ", ") + ColorReset)
+			}
+			l.broadcast(bannerMsg(g))
+		}
+		if fresh {
+			l.broadcast(NetMsg{T: "turn", Idx: t.Idx})
+			l.sync(g)
+			if t.Idx == 0 {
+				fmt.Println("\n" + ColorGreen + "Your turn:" + ColorReset)
+				fmt.Println(ColorYellow + "First roll will happen automatically; then choose dice to keep or bank." + ColorReset)
+			} else {
+				fmt.Println("\n" + ColorRed + g.Players[t.Idx].Name + "'s turn:" + ColorReset)
+			}
+		}
+
+		if p := g.Current(); p.Bot != nil {
+			points := enemyTurn(g)
+			fmt.Printf("%s banked %d points. New total: %d\n", p.Name, points, p.Total)
+			continue
+		}
+
+		if t.Roll == nil {
+			events, _ := g.Roll()
+			if t.Idx == 0 {
+				renderDice(events[0].Dice)
+			} else {
+				renderPeerDice(events[0].Dice)
+			}
+			if hasEvent(events, EvFarkle) {
+				if t.Idx == 0 {
+					fmt.Println(ColorRed + "Farkle! You scored 0 this turn." + ColorReset)
+				} else {
+					fmt.Println(ColorRed + g.Players[t.Idx].Name + " Farkled!" + ColorReset)
+				}
+				printPenalty(g, events)
+				continue
+			}
+		}
+
+		if t.Idx == 0 {
+			hostTurnLoop(g)
+			continue
+		}
+		remoteTurn(g, l, l.remotes[t.Idx-1])
+	}
+}
+
+// remoteTurn asks seat r for its keep or bank on the pending roll. Illegal
+// actions are rejected and may be retried. The game pauses while a dropped
+// player reconnects; a player who does not come back is handed to the
+// lobby's drop policy.
+func remoteTurn(g *Game, l *lobby, r *remote) {
+	if !r.gone {
+		l.sendTo(r, NetMsg{T: "your_turn"})
+	}
+	rejects := 0
+	for !r.gone {
+		in := <-l.inbox
+		switch {
+		case in.err != nil:
+			l.lost(g, in)
+		case in.msg.T == "leave":
+			abandon(g, l, in.r, in.r.name+" left the game")
+		case in.msg.T != "action":
+		case in.r != r:
+			l.reject(g, in.r, in.msg, errors.New("it is not your turn"), false)
+		default:
+			events, err := applyAction(g, l, r, in.msg)
+			if err == nil {
+				printRemote(g, r.seat, events)
+				return
+			}
+			if rejects++; rejects < maxRejects {
+				l.reject(g, r, in.msg, err, true)
+				continue
+			}
+			l.reject(g, r, in.msg, err, false)
+			text := r.name + " sent too many illegal actions; their turn ends."
+			fmt.Println(ColorRed + text + ColorReset)
+			l.broadcast(NetMsg{T: "notice", Text: text})
+			printPenalty(g, g.Bust())
+			return
+		}
+	}
+}
+
+// applyAction plays a remote seat's keep or bank. Every seat goes through
+// the engine, which checks the kept dice against the roll the host dealt,
+// so a modified client cannot keep dice it never rolled.
+func applyAction(g *Game, l *lobby, r *remote, act NetMsg) ([]Event, error) {
+	if !act.Bank {
+		return g.Keep(act.Keep)
+	}
+	events, err := g.Bank(act.Keep)
+	var open *OpeningError
+	if errors.As(err, &open) {
+		// Not on the board yet: score the keep and let the player roll on.
+		l.sendTo(r, NetMsg{T: "notice", Text: capitalize(open.Error()) + "."})
+		return g.Keep(act.Keep)
+	}
+	return events, err
+}
+
+// reject answers an illegal action with an error, carrying the roll to
+// retry on when retry is set, and notes the attempt on the host and in its
+// log.
+func (l *lobby) reject(g *Game, r *remote, act NetMsg, err error, retry bool) {
+	text := capitalize(err.Error()) + "."
+	msg := NetMsg{T: "error", Text: text}
+	if retry {
+		msg.Dice = g.Turn.Roll
+	}
+	l.sendTo(r, msg)
+	fmt.Printf(ColorRed+"Rejected %s's action (keep %v, roll %v): %s"+ColorReset+"\n", r.name, act.Keep, g.Turn.Roll, text)
+	l.log.Message(NetMsg{T: "rejected", Idx: r.seat, Keep: act.Keep, Bank: act.Bank, Dice: g.Turn.Roll, Text: text})
+}
+
+// abandon applies the lobby's drop policy to a player who is gone for
+// good: their seat forfeits or passes to the default computer player.
+func abandon(g *Game, l *lobby, r *remote, why string) {
+	if l.unseat(r) {
+		dropPolicy(g, l, r, why)
+	}
+}
+
+// unseat marks r gone for good and closes its connection. It reports false
+// if r was already gone.
+func (l *lobby) unseat(r *remote) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if r.gone {
+		return false
+	}
+	r.gone = true
+	r.conn.Close()
+	return true
+}
+
+// unseatMidRoll unseats r during a fair-dice draw. The game is in the
+// middle of a roll then, so settle applies the drop policy once the roll
+// is made.
+func (l *lobby) unseatMidRoll(r *remote, why string) {
+	if l.unseat(r) {
+		l.dropped = append(l.dropped, droppedSeat{r, why})
+	}
+}
+
+// settle applies the drop policy to the players dropped since it last ran.
+func (l *lobby) settle(g *Game) {
+	for _, d := range l.dropped {
+		dropPolicy(g, l, d.r, d.why)
+	}
+	l.dropped = nil
+}
+
+func dropPolicy(g *Game, l *lobby, r *remote, why string) {
+	if l.forfeit {
+		fmt.Println(ColorYellow + why + " and forfeits." + ColorReset)
+		if g.Forfeit(r.seat); g.Over {
+			fmt.Println(ColorYellow + "Everyone else has left." + ColorReset)
+		}
+		return
+	}
+	g.Players[r.seat].Bot, _ = NewStrategy(DefaultStrategy)
+	text := why + "; the computer takes over their seat."
+	fmt.Println(ColorYellow + text + ColorReset)
+	l.broadcast(NetMsg{T: "notice", Text: text})
+}
+
+// bannerMsg is the round scoreboard sent to every remote.
+func bannerMsg(g *Game) NetMsg {
+	msg := NetMsg{T: "banner", Round: g.Round, Target: g.Target}
+	for i, p := range g.Players {
+		if !g.OnBoard(i) {
+			msg.OffBoard = append(msg.OffBoard, i)
+		}
+		if p.Out {
+			msg.Forfeited = append(msg.Forfeited, i)
+		}
+		msg.Names = append(msg.Names, p.Name)
+		msg.Totals = append(msg.Totals, p.Total)
+		msg.Streaks = append(msg.Streaks, p.FarkleStreak)
+	}
+	return msg
+}
+
+// snapshotMsg is the full game state sent to a spectator who arrives late:
+// the banner fields plus whose turn it is, its unbanked points and any roll
+// awaiting a keep, and with fair dice the commitments and how many rolls
+// were made.
+func snapshotMsg(g *Game) NetMsg {
+	msg := bannerMsg(g)
+	msg.T, msg.Idx, msg.Turn, msg.Dice = "snapshot", g.Turn.Idx, g.Turn.Score, g.Turn.Roll
+	if fd, ok := g.Dice.(*FairDice); ok {
+		msg.Commits, msg.Count = fd.Commits, fd.Count
+	}
+	return msg
+}
+
+// printRemote shows the host what a remote player's keep or bank did.
+func printRemote(g *Game, seat int, events []Event) {
+	name := g.Players[seat].Name
+	for _, ev := range events {
+		switch ev.Type {
+		case EvKeep:
+			fmt.Printf("%s keeps %v gaining %d (turn total %d).\n", name, ev.Dice, ev.Delta, ev.Turn)
+		case EvHot:
+			fmt.Println(ColorYellow + name + " got hot dice!" + ColorReset)
+		case EvBank:
+			fmt.Printf(ColorBlue+"%s banks %d (total %d)."+ColorReset+"\n", name, ev.Delta, ev.Total)
+		}
+	}
+}
+
+//MARK: Host Turn Loop
+
+// hostTurnLoop prompts the host for the current roll and returns the events
+// produced by their keep or bank.
+func hostTurnLoop(g *Game) []Event {
+	promptText := ColorBlue + "Commands: 'keep X X...' (score & continue), 'bank X X...' (score & pass), 'hint', or 'quit'" + ColorReset
+	for {
+		fmt.Println(promptText)
+		kept, action := promptAction(g.Rules, g.Turn.Roll, g.Turn.Score, minBank(g), nil)
+		var events []Event
+		var err error
+		switch action {
+		case "quit":
+			fmt.Println("Goodbye!")
+			os.Exit(0)
+		case "keep":
+			events, err = g.Keep(kept)
+		case "bank":
+			events, err = g.Bank(kept)
+		}
+		if err != nil {
+			fmt.Println(capitalize(err.Error()) + ".")
+			continue
+		}
+		if action == "keep" {
+			fmt.Printf(ColorGreen+"Scored %d (turn total %d)."+ColorReset+"\n", events[0].Delta, g.Turn.Score)
+			if hasEvent(events, EvHot) {
+				fmt.Println(ColorYellow + "Hot dice!" + ColorReset)
+			}
+		} else {
+			bank, _ := findEvent(events, EvBank)
+			fmt.Printf(ColorGreen+"Banking %d (turn total %d)."+ColorReset+"\n", events[0].Delta, bank.Delta)
+		}
+		return events
+	}
+}
+
+// eventMsg is the NetMsg form of an engine event; turn changes have none.
+// Every message states the seat's pending turn points (Turn) separately
+// from its banked total (Total), so a client never has to work either out.
+func eventMsg(g *Game, ev Event) (NetMsg, bool) {
+	msg := NetMsg{T: string(ev.Type), Idx: ev.Idx, Round: ev.Round, Turn: ev.Turn, Total: ev.Total}
+	switch ev.Type {
+	case EvRoll:
+		msg.Dice = ev.Dice
+		if fd, ok := g.Dice.(*FairDice); ok {
+			msg.Links, msg.Count = fd.Links, fd.Count
+		}
+	case EvFarkle:
+		msg.Dice = ev.Dice
+	case EvKeep:
+		msg.Dice, msg.Delta = ev.Dice, ev.Delta
+	case EvHot:
+	case EvBank:
+		// The turn's points are banked: nothing is pending any more.
+		msg.T, msg.Delta, msg.Turn = "score", ev.Delta, 0
+	case EvPenalty:
+		msg.Delta = ev.Delta
+	case EvLastChance, EvForfeit:
+		msg.Turn = 0
+	case EvGameOver:
+		msg.Turn, msg.Standings = 0, g.Standings()
+	default:
+		return NetMsg{}, false
+	}
+	return msg, true
+}
+
+func printPenalty(g *Game, events []Event) {
+	if pen, ok := findEvent(events, EvPenalty); ok {
+		who := g.Players[pen.Idx].Name + "'s"
+		if pen.Idx == 0 {
+			who = "Your"
+		}
+		fmt.Printf(ColorRed+"%s third farkle in a row costs %d points (total %d)."+ColorReset+"\n", who, -pen.Delta, pen.Total)
+	}
+}
+
+//MARK: Peer Lobby
+
+// JoinOptions configure the peer side of a networked game.
+type JoinOptions struct {
+	Name  string        // profile name sent in hello
+	Watch bool          // join as a spectator
+	Log   *GameLog      // records the game messages the host sends
+	Stats *StatsTracker // counts the game for the peer's profile
+}
+
+// peer is a joined player's view of the game, built from host messages.
+type peer struct {
+	addr     string
+	secret   []byte     // from the lobby ID; keys the connection. Nil pairs instead
+	hello    NetMsg     // sent on every (re)connect
+	mu       sync.Mutex // guards enc and rtt; the reader and heartbeat write too
+	conn     net.Conn
+	enc      *json.Encoder
+	rtt      time.Duration
+	err      error // why the last connection ended
+	msgs     chan NetMsg
+	welcome  NetMsg
+	rules    *ScoringRules
+	seat     int
+	names    []string
+	lastRoll []int
+	turn     int  // our unbanked points
+	pending  bool // lastRoll is ours and still needs a keep or bank
+	onBoard  bool
+	watch    bool // spectating: seat is -1 and we never act
+
+	chain *FairChain // our fair-dice chain; nil when we take no part
+	rolls int        // rolls the host has shown us, so we reveal only the next link
+	fair  *RollCheck // checks each roll against the commitments
+	log   *GameLog
+}
+
+func (p *peer) name(i int) string {
+	if i == p.seat {
+		return "You"
+	}
+	if i >= 0 && i < len(p.names) {
+		return p.names[i]
+	}
+	return fmt.Sprintf("Player %d", i+1)
+}
+
+// JoinLobby connects to a host, waits in its lobby and plays as a peer.
+// A non-empty hostIP ("host" or "host:port") overrides the ID's address.
+// Without a lobby ID the peer pairs with the listed lobby at hostIP on the
+// local network and waits for the host to admit it.
+func JoinLobby(hostIP, lobbyID string, jo JoinOptions) {
+	host, port, secret := "", uint16(9313), []byte(nil)
+	if lobbyID != "" {
+		var err error
+		if host, port, secret, err = decodeLobbyID(lobbyID); err != nil {
+			fmt.Println(ColorRed + capitalize(err.Error()) + "." + ColorReset)
+			return
+		}
+	} else if hostIP == "" {
+		fmt.Println(ColorRed + "Joining without a lobby ID needs the address of a lobby on the local network." + ColorReset)
+		return
+	}
+	if h, p, err := net.SplitHostPort(hostIP); err == nil {
+		n, err := strconv.ParseUint(p, 10, 16)
+		if err != nil {
+			fmt.Println(ColorRed + "Invalid port in " + hostIP + "." + ColorReset)
+			return
+		}
+		host, port = h, uint16(n)
+	} else if hostIP != "" {
+		host = hostIP
+	}
+	addr := net.JoinHostPort(host, fmt.Sprint(port))
+	fmt.Println("Dialling", addr, "…")
+
+	p := &peer{addr: addr, secret: secret, hello: NetMsg{T: "hello", Version: protocolVersion, Caps: supportedCaps, Name: jo.Name, Watch: jo.Watch}, watch: jo.Watch}
+	welcome, err := p.connect()
+	if err != nil {
+		fmt.Println(ColorRed+"Connection failed:", err, ColorReset)
+		return
+	}
+	defer func() { p.conn.Close() }()
+	switch {
+	case welcome.T == "reject":
+		fmt.Println(ColorRed + "The host turned us away: " + welcome.Text + ColorReset)
+		return
+	case welcome.T == "notice":
+		fmt.Println(ColorYellow + welcome.Text + ColorReset)
+		return
+	case welcome.T != "welcome":
+		fmt.Println(ColorRed + "Handshake failed." + ColorReset)
+		return
+	case welcome.Version != protocolVersion:
+		fmt.Printf(ColorRed+"The host speaks protocol v%d but this client speaks v%d; please use the same release."+ColorReset+"\n", welcome.Version, protocolVersion)
+		return
+	}
+	rules := welcome.Rules
+	if rules == nil {
+		rules = ClassicRules
+	} else if err := rules.validate(); err != nil {
+		fmt.Println(ColorRed+"Host sent invalid rules:", err, ColorReset)
+		return
+	}
+	hostName := welcome.Name
+	if hostName == "" {
+		hostName = "Host"
+	}
+	fmt.Println(ColorGreen+"Connected to "+hostName+"'s lobby! Target score:", welcome.Target, "Rules:", rules.Name, ColorReset)
+	if welcome.Opening > 0 {
+		fmt.Printf(ColorBlue+"Opening score: %d"+ColorReset+"\n", welcome.Opening)
+	}
+	if welcome.Penalty > 0 {
+		fmt.Printf(ColorBlue+"Three farkles in a row cost %d"+ColorReset+"\n", welcome.Penalty)
+	}
+	if welcome.Final {
+		fmt.Println(ColorBlue + "Final round: reaching the target gives everyone else one more turn." + ColorReset)
+	}
+	if welcome.Fair {
+		fmt.Println(ColorBlue + "Fair dice: every roll will be drawn from links all players reveal for it, and checked." + ColorReset)
+		if jo.Log == nil {
+			jo.Log = transcriptLog()
+			defer jo.Log.Close()
+		}
+	}
+	if p.secret == nil {
+		// Paired: reconnect with the lobby ID the host handed us.
+		if _, _, secret, err := decodeLobbyID(welcome.ID); err == nil {
+			p.secret = secret
+			fmt.Println(ColorCyan + "The host let you in. Lobby ID: " + welcome.ID + ColorReset)
+		}
+	}
+	p.welcome, p.rules, p.onBoard, p.log = welcome, rules, welcome.Opening == 0, jo.Log
+	p.hello.Token = welcome.Token
+
+	if !p.waitStart() {
+		return
+	}
+	jo.Log.Start(p.names, welcome)
+	if jo.Stats != nil {
+		jo.Stats.Seat = p.seat
+		if jo.Stats.Opponent == "" {
+			var others []string
+			for i, n := range p.names {
+				if i != p.seat {
+					others = append(others, n)
+				}
+			}
+			jo.Stats.Opponent = strings.Join(others, ",")
+		}
+	}
+
+	for {
+		for msg := range p.msgs {
+			switch msg.T {
+			case "roll", "keep", "hot", "farkle", "score", "penalty", "last_chance", "forfeit", "game_over", "commits", "snapshot":
+				jo.Log.Message(msg)
+				jo.Stats.Message(msg)
+			}
+			if p.handle(msg) {
+				return
+			}
+		}
+		if !slices.Contains(p.welcome.Caps, capReconnect) || !p.reconnect() {
+			fmt.Println(ColorRed + "Connection lost." + ColorReset)
+			return
+		}
+	}
+}
+
+// connect dials the host, authenticates with the lobby secret (or pairs,
+// without one), sends hello and returns its reply; later
+// messages arrive on a fresh p.msgs, closed when the connection drops.
+func (p *peer) connect() (NetMsg, error) {
+	raw, err := net.DialTimeout("tcp", p.addr, 10*time.Second)
+	if err != nil {
+		return NetMsg{}, err
+	}
+	var conn net.Conn
+	wait := 10 * time.Second
+	if p.secret == nil {
+		var code string
+		if conn, code, err = pairHandshake(raw); err == nil {
+			fmt.Println(ColorYellow + "Your code is " + code + ". Ask the host to check it matches theirs and type 'admit " + code + "'." + ColorReset)
+			wait = pairWait
+		}
+	} else {
+		conn, err = clientHandshake(raw, p.secret)
+	}
+	if err != nil {
+		raw.Close()
+		return NetMsg{}, err
+	}
+	enc, dec := json.NewEncoder(conn), json.NewDecoder(conn)
+	enc.Encode(p.hello)
+	var reply NetMsg
+	conn.SetReadDeadline(time.Now().Add(wait))
+	if err := dec.Decode(&reply); err != nil {
+		conn.Close()
+		if p.secret == nil && timedOut(err) {
+			return NetMsg{}, errors.New("the host did not admit us in time")
+		}
+		return NetMsg{}, fmt.Errorf("handshake failed: %w", err)
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	msgs, done := make(chan NetMsg, 64), make(chan struct{})
+	go func() {
+		defer close(msgs)
+		defer close(done)
+		for {
+			var msg NetMsg
+			conn.SetReadDeadline(time.Now().Add(pongTimeout))
+			if err := dec.Decode(&msg); err != nil {
+				p.err = err
+				return
+			}
+			switch msg.T {
+			case "ping":
+				p.mu.Lock()
+				enc.Encode(NetMsg{T: "pong", Stamp: msg.Stamp})
+				p.mu.Unlock()
+			case "pong":
+				p.mu.Lock()
+				p.rtt = time.Since(time.Unix(0, msg.Stamp))
+				p.mu.Unlock()
+			default:
+				msgs <- msg
+			}
+		}
+	}()
+	go p.heartbeat(enc, done)
+	p.mu.Lock()
+	p.conn, p.enc, p.msgs = conn, enc, msgs
+	p.mu.Unlock()
+	return reply, nil
+}
+
+// heartbeat pings the host on enc until done is closed.
+func (p *peer) heartbeat(enc *json.Encoder, done <-chan struct{}) {
+	tick := time.NewTicker(pingInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-tick.C:
+			p.mu.Lock()
+			enc.Encode(NetMsg{T: "ping", Stamp: time.Now().UnixNano()})
+			p.mu.Unlock()
+		}
+	}
+}
+
+// send writes one message to the host.
+func (p *peer) send(msg NetMsg) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.enc.Encode(msg)
+}
+
+// reconnect redials the host after a dropped connection, presenting our
+// session token, for up to reconnectGrace. The host resyncs us with a
+// snapshot of the game.
+func (p *peer) reconnect() bool {
+	if timedOut(p.err) {
+		fmt.Printf(ColorYellow+"The host stopped responding (no reply for %.0f s); trying to reconnect…"+ColorReset+"\n", pongTimeout.Seconds())
+	} else {
+		fmt.Println(ColorYellow + "Connection lost; trying to reconnect…" + ColorReset)
+	}
+	p.conn.Close()
+	for deadline := time.Now().Add(reconnectGrace); time.Now().Before(deadline); {
+		time.Sleep(2 * time.Second)
+		reply, err := p.connect()
+		if err != nil {
+			continue
+		}
+		if reply.T != "welcome" {
+			p.conn.Close()
+			if reply.T == "notice" || reply.T == "reject" {
+				fmt.Println(ColorYellow + reply.Text + ColorReset)
+			}
+			return false
+		}
+		fmt.Println(ColorGreen + "Reconnected." + ColorReset)
+		return true
+	}
+	return false
+}
+
+// waitStart runs the peer's side of the waiting room until the host starts
+// the game. It reports false if the lobby closed or the player left.
+func (p *peer) waitStart() bool {
+	if p.watch {
+		fmt.Println(ColorBlue + "Watching – type 'quit' to leave before the game starts." + ColorReset)
+	} else {
+		fmt.Println(ColorBlue + "Type 'ready' when you are ready to play, or 'quit' to leave." + ColorReset)
+	}
+	for {
+		select {
+		case msg, ok := <-p.msgs:
+			if !ok {
+				fmt.Println(ColorRed + "The lobby closed." + ColorReset)
+				return false
+			}
+			switch msg.T {
+			case "lobby":
+				var who []string
+				for i, n := range msg.Names {
+					mark := "…"
+					if i < len(msg.Ready) && msg.Ready[i] {
+						mark = "✓"
+					}
+					who = append(who, n+" "+mark)
+				}
+				fmt.Println(ColorCyan + "Lobby: " + strings.Join(who, ", ") + ColorReset)
+			case "notice":
+				fmt.Println(ColorYellow + msg.Text + ColorReset)
+			case "start":
+				p.seat, p.names = msg.Idx, msg.Names
+				fmt.Println(ColorGreen + "The game is starting: " + strings.Join(p.names, ", ") + ColorReset)
+				return true
+			case "snapshot":
+				// Spectating a game already in progress.
+				p.seat, p.names = -1, msg.Names
+				fmt.Println(ColorGreen + "Watching a game in progress: " + strings.Join(p.names, ", ") + ColorReset)
+				p.handle(msg)
+				return true
+			}
+		case line, ok := <-Lines():
+			if !ok {
+				return false
+			}
+			switch strings.ToLower(strings.TrimSpace(line)) {
+			case "ready":
+				if p.watch {
+					fmt.Println("Spectators do not need to get ready.")
+					continue
+				}
+				p.send(NetMsg{T: "ready"})
+				fmt.Println(ColorGreen + "Ready! Waiting for the host to start." + ColorReset)
+			case "quit", "exit":
+				return false
+			case "":
+			default:
+				fmt.Println(ColorBlue + "Lobby commands: 'ready' or 'quit'." + ColorReset)
+			}
+		}
+	}
+}
+
+// handle shows one game message; it reports true once the game is over.
+func (p *peer) handle(msg NetMsg) bool {
+	who := p.name(msg.Idx)
+	mine := msg.Idx == p.seat
+	switch msg.T {
+	case "roll", "keep", "hot", "farkle", "score":
+		if mine {
+			p.turn = msg.Turn // the host's count of our unbanked points
+		}
+	}
+	switch msg.T {
+	case "banner", "snapshot":
+		fmt.Printf("\n========================\n")
+		fmt.Printf(" ROUND %d – First to %d\n", msg.Round, msg.Target)
+		fmt.Printf("========================\n")
+		board := make([]string, len(msg.Names))
+		for i, n := range msg.Names {
+			off := false
+			for _, o := range msg.OffBoard {
+				off = off || o == i
+			}
+			streak, total := 0, 0
+			if i < len(msg.Streaks) {
+				streak = msg.Streaks[i]
+			}
+			if i < len(msg.Totals) {
+				total = msg.Totals[i]
+			}
+			color := ColorYellow
+			if i == p.seat {
+				n, color = "You", ColorGreen
+			}
+			note := boardNote(off, streak)
+			for _, o := range msg.Forfeited {
+				if o == i {
+					note = ColorRed + " (forfeited)" + ColorReset
+				}
+			}
+			board[i] = fmt.Sprintf("%s%s%s: %d%s", color, n, ColorReset, total, note)
+		}
+		fmt.Println("Scoreboard → " + strings.Join(board, " | "))
+		p.mu.Lock()
+		rtt := p.rtt
+		p.mu.Unlock()
+		if rtt > 0 {
+			fmt.Println(ColorCyan + "Ping → " + pingText(rtt) + ColorReset)
+		}
+		if msg.T == "snapshot" {
+			if p.fair == nil && len(msg.Commits) > 0 {
+				p.fair, _ = NewRollCheck(msg.Commits)
+			}
+			if p.fair != nil {
+				p.fair.SkipTo(msg.Count)
+			}
+			p.rolls = msg.Count
+			p.resync(msg)
+		}
+	case "turn":
+		if mine {
+			p.turn = 0
+			fmt.Println("\n" + ColorGreen + "Your turn:" + ColorReset)
+		} else {
+			fmt.Println("\n" + ColorRed + who + "'s turn:" + ColorReset)
+		}
+	case "roll":
+		if mine {
+			renderDice(msg.Dice)
+			p.lastRoll, p.pending = msg.Dice, true
+		} else {
+			renderPeerDice(msg.Dice)
+		}
+		p.rolls = max(p.rolls, msg.Count)
+		if p.fair == nil {
+			break
+		}
+		if err := p.fair.Check(msg.Count, msg.Links, msg.Dice); err != nil {
+			fmt.Println(ColorRed + "⚠ This roll does not follow from the fair-dice commitments: " + err.Error() + "!" + ColorReset)
+		}
+		if p.chain == nil {
+			break
+		}
+		if own, ok := p.chain.Link(msg.Count); ok && (p.seat >= len(msg.Links) || msg.Links[p.seat] != own) {
+			fmt.Println(ColorRed + "⚠ The host left our fair-dice link out of this roll!" + ColorReset)
+		}
+	case "fair":
+		if !p.watch {
+			p.chain = NewFairChain()
+			p.send(NetMsg{T: "commit", Commit: p.chain.Commit()})
+		}
+	case "commits":
+		fair, err := NewRollCheck(msg.Commits)
+		if err != nil {
+			fmt.Println(ColorRed + "Fair dice check failed: " + err.Error() + ColorReset)
+			break
+		}
+		p.fair = fair
+		if p.chain != nil && (p.seat < 0 || p.seat >= len(msg.Commits) || msg.Commits[p.seat] != p.chain.Commit()) {
+			fmt.Println(ColorRed + "The host did not publish our fair-dice commitment; we will not reveal any links." + ColorReset)
+			p.chain = nil
+		}
+		fmt.Println(ColorGreen + "Fair dice agreed: every roll is drawn from links all players reveal for it." + ColorReset)
+	case "draw":
+		if p.chain == nil {
+			break
+		}
+		if msg.Count != p.rolls+1 {
+			// A link for a later roll would let the host work out that roll early.
+			fmt.Printf(ColorRed+"The host asked for our link for roll %d before showing roll %d; not revealing it."+ColorReset+"\n", msg.Count, msg.Count-1)
+			break
+		}
+		if link, ok := p.chain.Link(msg.Count); ok {
+			p.send(NetMsg{T: "link", Count: msg.Count, Link: link})
+		}
+	case "your_turn":
+		p.act()
+	case "keep":
+		if mine {
+			fmt.Printf(ColorGreen+"Scored %d (turn total %d)."+ColorReset+"\n", msg.Delta, msg.Turn)
+		} else {
+			fmt.Printf("%s keeps %v gaining %d (turn total %d).\n", who, msg.Dice, msg.Delta, msg.Turn)
+		}
+	case "farkle":
+		if mine {
+			fmt.Println(ColorRed + "You Farkled." + ColorReset)
+			p.pending = false
+		} else {
+			fmt.Println(ColorRed + who + " Farkled." + ColorReset)
+		}
+	case "score":
+		if mine {
+			fmt.Printf(ColorGreen+"You scored %d (total %d)"+ColorReset+"\n", msg.Delta, msg.Total)
+			p.onBoard = true
+		} else {
+			fmt.Printf(ColorYellow+"%s scored %d (total %d)"+ColorReset+"\n", who, msg.Delta, msg.Total)
+		}
+	case "last_chance":
+		if mine {
+			fmt.Printf(ColorYellow+"Final round! You reached %d – everyone else gets one more turn."+ColorReset+"\n", msg.Total)
+		} else {
+			fmt.Printf(ColorYellow+"Final round! %s reached %d – you get one more turn to beat it."+ColorReset+"\n", who, msg.Total)
+		}
+	case "game_over":
+		if len(msg.Standings) > 0 {
+			standings := msg.Standings
+			for i := range standings {
+				standings[i].Name = p.name(standings[i].Idx)
+			}
+			printStandings(standings)
+		}
+		if mine {
+			fmt.Println(ColorGreen + "🏆 You win! Returning to menu." + ColorReset)
+		} else if p.watch {
+			fmt.Println(ColorGreen + who + " wins. Returning to menu." + ColorReset)
+		} else {
+			fmt.Println(ColorRed + "💀 " + who + " wins. Returning to menu." + ColorReset)
+		}
+		switch {
+		case p.fair != nil:
+			fmt.Println(p.fair.Summary())
+		case p.welcome.Fair:
+			fmt.Println(ColorRed + "Fair dice: the commitments were never agreed, so the rolls could not be checked." + ColorReset)
+		}
+		if path := p.log.Path(); path != "" && p.welcome.Fair {
+			fmt.Println("Transcript: " + path + " – check it with 'verify " + path + "'.")
+		}
+		return true
+	case "notice":
+		fmt.Println(ColorYellow + msg.Text + ColorReset)
+	case "penalty":
+		if mine {
+			fmt.Printf(ColorRed+"Third farkle in a row! You lose %d points (total %d)."+ColorReset+"\n", -msg.Delta, msg.Total)
+		} else {
+			fmt.Printf(ColorRed+"%s's third farkle in a row costs %d points."+ColorReset+"\n", who, -msg.Delta)
+		}
+	case "hot":
+		if mine {
+			fmt.Printf(ColorYellow+"Hot dice! Rolling all 6 again with %d pending..."+ColorReset+"\n", msg.Turn)
+		} else {
+			fmt.Printf(ColorYellow+"%s got hot dice (turn total %d)!"+ColorReset+"\n", who, msg.Turn)
+		}
+	case "error":
+		// The host rejected our action; retry on the roll it sends back.
+		fmt.Println(ColorRed + "Host: " + msg.Text + ColorReset)
+		if len(msg.Dice) > 0 && !p.watch {
+			p.lastRoll, p.pending = msg.Dice, true
+			p.act()
+		}
+	case "forfeit":
+		if mine {
+			fmt.Println(ColorRed + "You forfeited the game." + ColorReset)
+		} else {
+			fmt.Println(ColorYellow + who + " forfeits." + ColorReset)
+		}
+	}
+	return false
+}
+
+// resync picks up the turn in progress from a snapshot, prompting at once
+// if the pending roll is ours.
+func (p *peer) resync(msg NetMsg) {
+	p.onBoard = true
+	for _, o := range msg.OffBoard {
+		p.onBoard = p.onBoard && o != p.seat
+	}
+	if msg.Idx != p.seat {
+		fmt.Printf("\n"+ColorRed+"%s's turn (turn total %d):"+ColorReset+"\n", p.name(msg.Idx), msg.Turn)
+		if len(msg.Dice) > 0 {
+			renderPeerDice(msg.Dice)
+		}
+		return
+	}
+	fmt.Printf("\n"+ColorGreen+"Your turn (turn total %d):"+ColorReset+"\n", msg.Turn)
+	p.turn, p.lastRoll, p.pending = msg.Turn, msg.Dice, len(msg.Dice) > 0
+	if p.pending {
+		renderDice(msg.Dice)
+		p.act()
+	}
+}
+
+// act prompts for our keep or bank on the pending roll. A repeated
+// your_turn for a roll already answered is ignored.
+func (p *peer) act() {
+	if !p.pending {
+		return
+	}
+	need := 0
+	if !p.onBoard {
+		need = p.welcome.Opening
+	}
+	turnLoopPeer(p.send, p.rules, p.lastRoll, p.turn, need)
+	p.pending = false
+}
+
+// turnLoopPeer sends the peer's keep or bank for roll.
+func turnLoopPeer(send func(NetMsg), rules *ScoringRules, roll []int, turnScore, minBank int) {
+	promptText := ColorBlue + "Commands: 'keep X X...' (score & continue), 'bank X X...' (score & pass), 'hint', or 'quit'" + ColorReset
+	for {
+		fmt.Println(promptText)
+		kept, action := promptAction(rules, roll, turnScore, minBank, nil)
+		switch action {
+		case "quit":
+			send(NetMsg{T: "leave"})
+			fmt.Println("Goodbye!")
+			os.Exit(0)
+		case "keep":
+			send(NetMsg{T: "action", Keep: kept, Bank: false})
+			return
+		case "bank":
+			send(NetMsg{T: "action", Keep: kept, Bank: true})
+			return
+		}
+	}
+}
+
+//------------------------------------------------------------
+// A lobby ID is Base32 of a header byte (format version in the high nibble,
+// address kind in the low), the host address, the port (2B) and the lobby
+// secret (10B), then a checksum byte (the first byte of SHA-256 of the rest,
+// kept last in every version) that catches most typos. The address is 4
+// bytes for IPv4, 16 for IPv6, or a length byte and up to maxLobbyHost
+// characters for a hostname.
+const (
+	lobbyIDVersion = 1
+	addrIPv4       = 1
+	addrIPv6       = 2
+	addrHost       = 3
+	maxLobbyHost   = 63
+)
+
+var lobbyHostname = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?$`)
+
+// encodeLobbyID builds the lobby ID for host (an IP address or hostname),
+// port and secret.
+func encodeLobbyID(host string, port uint16, secret []byte) (string, error) {
+	buf := []byte{0}
+	ip := net.ParseIP(host)
+	switch {
+	case ip.To4() != nil:
+		buf[0] = lobbyIDVersion<<4 | addrIPv4
+		buf = append(buf, ip.To4()...)
+	case ip != nil:
+		buf[0] = lobbyIDVersion<<4 | addrIPv6
+		buf = append(buf, ip.To16()...)
+	case len(host) > maxLobbyHost || !lobbyHostname.MatchString(host):
+		return "", fmt.Errorf("%q is not an IP address or a hostname of up to %d characters", host, maxLobbyHost)
+	default:
+		buf[0] = lobbyIDVersion<<4 | addrHost
+		buf = append(buf, byte(len(host)))
+		buf = append(buf, host...)
+	}
+	buf = binary.BigEndian.AppendUint16(buf, port)
+	buf = append(buf, secret...)
+	buf = append(buf, lobbyIDSum(buf))
+	return strings.ToUpper(b32.EncodeToString(buf)), nil
+}
+
+func lobbyIDSum(data []byte) byte {
+	sum := sha256.Sum256(data)
+	return sum[0]
+}
+
+// decodeLobbyID unpacks the host, port and secret of a lobby ID.
+func decodeLobbyID(id string) (string, uint16, []byte, error) {
+	errFormat := errors.New("invalid lobby ID format")
+	data, err := b32.DecodeString(strings.ToUpper(strings.TrimSpace(id)))
+	if err != nil || len(data) < 2 {
+		return "", 0, nil, errFormat
+	}
+	data, sum := data[:len(data)-1], data[len(data)-1]
+	if lobbyIDSum(data) != sum {
+		return "", 0, nil, errors.New("this lobby ID has a typo (its checksum does not match)")
+	}
+	if v := int(data[0] >> 4); v != lobbyIDVersion {
+		return "", 0, nil, fmt.Errorf("this lobby ID was made by a different release (format v%d; this one reads v%d)", v, lobbyIDVersion)
+	}
+	var host string
+	rest := data[1:]
+	switch data[0] & 0x0f {
+	case addrIPv4:
+		if len(rest) < net.IPv4len {
+			return "", 0, nil, errFormat
+		}
+		host, rest = net.IP(rest[:net.IPv4len]).String(), rest[net.IPv4len:]
+	case addrIPv6:
+		if len(rest) < net.IPv6len {
+			return "", 0, nil, errFormat
+		}
+		host, rest = net.IP(rest[:net.IPv6len]).String(), rest[net.IPv6len:]
+	case addrHost:
+		if len(rest) < 1 || int(rest[0]) > maxLobbyHost || len(rest) < 1+int(rest[0]) {
+			return "", 0, nil, errFormat
+		}
+		host, rest = string(rest[1:1+rest[0]]), rest[1+rest[0]:]
+		if !lobbyHostname.MatchString(host) {
+			return "", 0, nil, errFormat
+		}
+	default:
+		return "", 0, nil, errFormat
+	}
+	if len(rest) != 2+secretBytes {
+		return "", 0, nil, errFormat
+	}
+	return host, binary.BigEndian.Uint16(rest[:2]), rest[2:], nil
+}
+
+// getOutboundIP picks the address to put in a lobby ID: a non-loopback
+// IPv4 address if there is one, otherwise a global IPv6 address, so hosts
+// on IPv6-only networks still share a working ID.
+func getOutboundIP() string {
+	if v4 := getOutboundIPv4(); v4 != "127.0.0.1" {
+		return v4
+	}
+	addrs, _ := net.InterfaceAddrs()
+	for _, a := range addrs {
+		if ipnet, ok := a.(*net.IPNet); ok && ipnet.IP.To4() == nil && ipnet.IP.IsGlobalUnicast() {
+			return ipnet.IP.String()
+		}
+	}
+	return "127.0.0.1"
 }
 
 func getOutboundIPv4() string {
@@ -0,0 +1,240 @@
+package farkle
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestWaitingRoomRace runs players joining, readying and leaving the waiting
+// room while the heartbeat and the LAN responder read the seat list, as they
+// do in a real lobby. Run it with -race.
+func TestWaitingRoomRace(t *testing.T) {
+	linesOnce.Do(func() {}) // the test types the host's commands itself
+
+	l := &lobby{name: "Host", inbox: make(chan inbound, 64), back: make(chan struct{}, 1), open: maxRemotes}
+	joins := make(chan *remote)
+	done := make(chan bool)
+	go func() { done <- waitingRoom(l, joins) }()
+
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				l.broadcast(NetMsg{T: "ping", Stamp: time.Now().UnixNano()})
+				l.info(9313)
+			}
+		}
+	}()
+
+	var clients []net.Conn
+	for i := 0; i < 3; i++ {
+		host, client := net.Pipe()
+		go io.Copy(io.Discard, client)
+		clients = append(clients, client)
+		joins <- &remote{name: "Peer", conn: host, enc: json.NewEncoder(host), dec: json.NewDecoder(host)}
+	}
+	for _, c := range clients[:2] {
+		json.NewEncoder(c).Encode(NetMsg{T: "ready"})
+	}
+	clients[2].Close()
+
+	seated := func() (n, ready int) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		for _, r := range l.remotes {
+			if r.ready {
+				ready++
+			}
+		}
+		return len(l.remotes), ready
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		n, ready := seated()
+		if n == 2 && ready == 2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("lobby has %d players, %d ready; want 2 and 2", n, ready)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	lines <- "start"
+	if !<-done {
+		t.Fatal("waiting room did not start with everyone ready")
+	}
+	l.close("")
+}
+
+// TestPlainClientRejected checks that clients sending their hello in the
+// clear, as releases before the secure channel do, are told why they
+// cannot join instead of timing out.
+func TestPlainClientRejected(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	l := &lobby{name: "Host", secret: newLobbySecret(), welcome: NetMsg{T: "welcome", Version: protocolVersion}}
+	stop := make(chan struct{})
+	defer close(stop)
+	go l.acceptLoop(ln, make(chan *remote), stop)
+
+	for _, tt := range []struct {
+		name  string
+		hello NetMsg
+		want  string
+	}{
+		{"unversioned", NetMsg{T: "hello", Name: "Old"}, "predates versioning"},
+		{"current caps in the clear", NetMsg{T: "hello", Version: protocolVersion, Caps: supportedCaps}, "the encrypted lobby handshake"},
+	} {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		json.NewEncoder(conn).Encode(tt.hello)
+		var reply NetMsg
+		if err := json.NewDecoder(conn).Decode(&reply); err != nil || reply.T != "reject" || !strings.Contains(reply.Text, tt.want) {
+			t.Errorf("%s: reply %+v, %v; want a reject mentioning %q", tt.name, reply, err, tt.want)
+		}
+		conn.Close()
+	}
+}
+
+// TestPairedJoin pairs a client with a listed lobby, as 'lobbies' does, and
+// checks that it is seated only once the host types its code.
+func TestPairedJoin(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	secret := newLobbySecret()
+	id, _ := encodeLobbyID("127.0.0.1", 9313, secret)
+	l := &lobby{name: "Host", inbox: make(chan inbound, 64), secret: secret, id: id, lan: true, open: maxRemotes, welcome: NetMsg{T: "welcome", Version: protocolVersion}}
+	joins := make(chan *remote)
+	stop := make(chan struct{})
+	defer close(stop)
+	go l.acceptLoop(ln, joins, stop)
+
+	raw, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer raw.Close()
+	conn, code, err := pairHandshake(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	json.NewEncoder(conn).Encode(NetMsg{T: "hello", Version: protocolVersion, Caps: supportedCaps, Name: "Alice"})
+	r := <-joins
+	if r.code != code {
+		t.Fatalf("host sees code %q, client %q", r.code, code)
+	}
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	pairing := l.admitCode([]*remote{r}, wrong)
+	if len(pairing) != 1 || len(l.remotes) != 0 {
+		t.Fatalf("wrong code: %d waiting, %d seated", len(pairing), len(l.remotes))
+	}
+	if pairing = l.admitCode(pairing, code); len(pairing) != 0 || len(l.remotes) != 1 {
+		t.Fatalf("right code: %d waiting, %d seated", len(pairing), len(l.remotes))
+	}
+	var welcome NetMsg
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if err := json.NewDecoder(conn).Decode(&welcome); err != nil || welcome.T != "welcome" || welcome.ID != id {
+		t.Errorf("welcome %+v, %v; want one carrying the lobby ID", welcome, err)
+	}
+	l.close("")
+}
+
+// rawLobbyID encodes data as a lobby ID with a correct checksum.
+func rawLobbyID(data ...byte) string {
+	return b32.EncodeToString(append(data, lobbyIDSum(data)))
+}
+
+func TestLobbyIDRoundTrip(t *testing.T) {
+	secret := []byte("0123456789")
+	for _, tt := range []struct {
+		host string
+		port uint16
+		kind byte
+	}{
+		{"192.0.2.7", 9313, addrIPv4},
+		{"127.0.0.1", 1, addrIPv4},
+		{"2001:db8::42", 9313, addrIPv6},
+		{"::1", 65535, addrIPv6},
+		{"farkle.example.org", 9313, addrHost},
+		{"h", 9313, addrHost},
+		{strings.Repeat("a", maxLobbyHost), 9313, addrHost},
+	} {
+		id, err := encodeLobbyID(tt.host, tt.port, secret)
+		if err != nil {
+			t.Errorf("encode %s: %v", tt.host, err)
+			continue
+		}
+		if raw, _ := b32.DecodeString(id); raw[0] != lobbyIDVersion<<4|tt.kind {
+			t.Errorf("encode %s: header %#x, want kind %d", tt.host, raw[0], tt.kind)
+		}
+		for _, in := range []string{id, strings.ToLower(id), " " + id + "\n"} {
+			host, port, got, err := decodeLobbyID(in)
+			if err != nil || host != tt.host || port != tt.port || string(got) != string(secret) {
+				t.Errorf("decode %q = %s %d %q %v; want %s %d", in, host, port, got, err, tt.host, tt.port)
+			}
+		}
+	}
+}
+
+func TestLobbyIDRejects(t *testing.T) {
+	secret := []byte("0123456789")
+	id, _ := encodeLobbyID("192.0.2.7", 9313, secret)
+	typo := []byte(id)
+	if typo[8] = 'A'; id[8] == 'A' {
+		typo[8] = 'B'
+	}
+	body := append([]byte{lobbyIDVersion<<4 | addrIPv4, 192, 0, 2, 7, 0x24, 0x61}, secret...)
+	port := []byte{0x24, 0x61}
+
+	for _, tt := range []struct {
+		name, id, err string
+	}{
+		{"empty", "", "invalid lobby ID format"},
+		{"not base32", "NOT-A-LOBBY", "invalid lobby ID format"},
+		{"truncated", id[:len(id)-4], "typo"},
+		{"truncated to the header", id[:2], "invalid lobby ID format"},
+		{"typo", string(typo), "typo"},
+		{"bad checksum", b32.EncodeToString(append(slices.Clone(body), lobbyIDSum(body)+1)), "typo"},
+		{"newer version", rawLobbyID(append([]byte{2<<4 | addrIPv4}, body[1:]...)...), "different release (format v2"},
+		{"unknown address kind", rawLobbyID(append([]byte{lobbyIDVersion<<4 | 7}, body[1:]...)...), "invalid lobby ID format"},
+		{"short address", rawLobbyID(append([]byte{lobbyIDVersion<<4 | addrIPv6}, body[1:]...)...), "invalid lobby ID format"},
+		{"short secret", rawLobbyID(body[:len(body)-1]...), "invalid lobby ID format"},
+		{"long secret", rawLobbyID(append(slices.Clone(body), 0)...), "invalid lobby ID format"},
+		{"hostname past its data", rawLobbyID(append([]byte{lobbyIDVersion<<4 | addrHost, 40}, "short"...)...), "invalid lobby ID format"},
+		{"over-long hostname", rawLobbyID(slices.Concat([]byte{lobbyIDVersion<<4 | addrHost, maxLobbyHost + 1}, []byte(strings.Repeat("a", maxLobbyHost+1)), port, secret)...), "invalid lobby ID format"},
+		{"bad hostname", rawLobbyID(slices.Concat([]byte{lobbyIDVersion<<4 | addrHost, 5}, []byte("a_b.c"), port, secret)...), "invalid lobby ID format"},
+	} {
+		if _, _, _, err := decodeLobbyID(tt.id); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: decode %q: err = %v, want %q", tt.name, tt.id, err, tt.err)
+		}
+	}
+
+	for _, host := range []string{strings.Repeat("a", maxLobbyHost+1), "a_b.example", "-farkle", ""} {
+		if id, err := encodeLobbyID(host, 9313, secret); err == nil {
+			t.Errorf("encode %q = %s, want an error", host, id)
+		}
+	}
+}
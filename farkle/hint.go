@@ -0,0 +1,100 @@
+package farkle
+
+import (
+	"sort"
+	"sync"
+
+	"farkle/farkle/solver"
+)
+
+// MARK: Hints
+
+// KeepOption is one legal keep from a roll, as listed by the hint command.
+type KeepOption struct {
+	Dice         []int
+	Points       int
+	DiceLeft     int     // dice to roll next (6 after hot dice)
+	FarkleChance float64 // chance that rolling DiceLeft dice farkles
+	Value        float64 // expected turn total when playing on optimally
+	Roll         bool    // optimal play rolls again after this keep
+}
+
+// Advice lists every legal keep of a roll, best first.
+type Advice struct {
+	Turn    int
+	Options []KeepOption
+}
+
+// Best is the recommended keep, or nil when the roll has none.
+func (a Advice) Best() *KeepOption {
+	if len(a.Options) == 0 {
+		return nil
+	}
+	return &a.Options[0]
+}
+
+// Advise evaluates every keep of roll with turn unbanked points. Banking is
+// only considered once the turn total reaches minBank (the opening score for
+// a player who is not on the board yet).
+func Advise(rules *ScoringRules, roll []int, turn, minBank int) Advice {
+	p := policyFor(rules)
+	a := Advice{Turn: turn}
+	for _, k := range solver.Keeps(roll, rules.KeepScore) {
+		next := solver.After(solver.State{Turn: turn}, len(roll), k, rules.KeepScore)
+		opt := KeepOption{
+			Dice:         k,
+			Points:       next.Turn - turn,
+			DiceLeft:     next.Dice,
+			FarkleChance: p.farkle[next.Dice],
+			Value:        p.ev.Value(next),
+			Roll:         p.ev.ShouldRoll(next),
+		}
+		if next.Turn < minBank {
+			opt.Roll = true
+			opt.Value = p.rollValue(next)
+		}
+		a.Options = append(a.Options, opt)
+	}
+	sort.SliceStable(a.Options, func(i, j int) bool {
+		x, y := a.Options[i], a.Options[j]
+		if x.Value != y.Value {
+			return x.Value > y.Value
+		}
+		return x.Points > y.Points
+	})
+	return a
+}
+
+type policy struct {
+	ev     *solver.EVTable
+	farkle [7]float64
+}
+
+// rollValue is the expected turn total when rolling on from s regardless of
+// whether banking would be better.
+func (p *policy) rollValue(s solver.State) float64 {
+	if s.Turn >= p.ev.Cap {
+		return float64(s.Turn)
+	}
+	return float64(p.ev.Roll[(s.Turn/p.ev.Step)*6+s.Dice-1])
+}
+
+var (
+	policyMu sync.Mutex
+	policies = make(map[*ScoringRules]*policy)
+)
+
+// policyFor solves (once per rule set) the expected-value table used for hints.
+func policyFor(rules *ScoringRules) *policy {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+	if p, ok := policies[rules]; ok {
+		return p
+	}
+	p := &policy{ev: solver.SolveEV(rules.KeepScore, 50, 20000)}
+	for n := 1; n <= 6; n++ {
+		p.farkle[n] = solver.FarkleChance(n, rules.KeepScore)
+	}
+	policies[rules] = p
+	return p
+}
@@ -0,0 +1,211 @@
+package farkle
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// MARK: Game log
+
+// LogEntry is one line of a JSONL game log. Events use the NetMsg types
+// ("roll", "keep", "hot", "farkle", "score", "penalty", "last_chance",
+// "forfeit", "game_over"); the first line is a "start" entry naming the
+// players. A host's log also notes the remote actions it "rejected".
+type LogEntry struct {
+	Time time.Time `json:"time"`
+	NetMsg
+}
+
+// GameLog writes a game's events to a JSONL file. It is a Recorder for
+// games driven locally; networked peers log the messages they receive.
+type GameLog struct {
+	path    string
+	f       *os.File
+	enc     *json.Encoder
+	started bool
+}
+
+// CreateLog starts a new log at path, replacing any existing file.
+func CreateLog(path string) (*GameLog, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return &GameLog{path: path, f: f, enc: json.NewEncoder(f)}, nil
+}
+
+// Path is the file the log writes to; "" for a nil log.
+func (l *GameLog) Path() string {
+	if l == nil {
+		return ""
+	}
+	return l.path
+}
+
+// Close flushes and closes the log file. A nil log is a no-op.
+func (l *GameLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	return l.f.Close()
+}
+
+// Record implements Recorder.
+func (l *GameLog) Record(g *Game, events []Event) {
+	if !l.started {
+		names := make([]string, len(g.Players))
+		for i, p := range g.Players {
+			names[i] = p.Name
+		}
+		l.Start(names, NetMsg{Target: g.Target, Rules: g.Rules, Opening: g.OpeningScore, Penalty: g.FarklePenalty, Final: g.FinalRound})
+	}
+	for _, ev := range events {
+		if msg, ok := eventMsg(g, ev); ok {
+			l.Message(msg)
+		}
+	}
+}
+
+// Start writes the "start" entry; settings carries the welcome fields.
+func (l *GameLog) Start(names []string, settings NetMsg) {
+	if l == nil || l.started {
+		return
+	}
+	l.started = true
+	settings.T, settings.Names = "start", names
+	l.enc.Encode(LogEntry{Time: time.Now().UTC(), NetMsg: settings})
+}
+
+// Message logs one event message. A nil log is a no-op.
+func (l *GameLog) Message(msg NetMsg) {
+	if l == nil {
+		return
+	}
+	l.enc.Encode(LogEntry{Time: time.Now().UTC(), NetMsg: msg})
+}
+
+// ReadLog loads every entry of a game log.
+func ReadLog(path string) ([]LogEntry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var entries []LogEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1<<20)
+	for line := 1; sc.Scan(); line++ {
+		if strings.TrimSpace(sc.Text()) == "" {
+			continue
+		}
+		var e LogEntry
+		if err := json.Unmarshal(sc.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 || entries[0].T != "start" {
+		return nil, fmt.Errorf("%s is not a game log", path)
+	}
+	return entries, nil
+}
+
+// MARK: Replay
+
+// Replay steps through a game log turn by turn, waiting for Enter between
+// turns ('q' stops early).
+func Replay(path string) error {
+	entries, err := ReadLog(path)
+	if err != nil {
+		return err
+	}
+	start := entries[0]
+	names := start.Names
+	totals := make([]int, len(names))
+	name := func(i int) string {
+		if i >= 0 && i < len(names) {
+			return names[i]
+		}
+		return fmt.Sprintf("Player %d", i+1)
+	}
+
+	rules := "classic"
+	if start.Rules != nil {
+		rules = start.Rules.Name
+	}
+	fmt.Printf(ColorBlue+"Replaying %s (%s): %s, first to %d, rules %s"+ColorReset+"\n",
+		path, start.Time.Local().Format("2006-01-02 15:04"), strings.Join(names, " vs "), start.Target, rules)
+	fmt.Println(ColorBlue + "Press Enter for the next turn, or 'q' to stop." + ColorReset)
+
+	turnOver := true
+	for _, e := range entries[1:] {
+		if e.T == "roll" && turnOver {
+			if !waitReplay() {
+				return nil
+			}
+			fmt.Printf("\n========================\n")
+			fmt.Printf(" ROUND %d – %s\n", e.Round, e.Time.Local().Format("15:04:05"))
+			fmt.Printf("========================\n")
+			board := make([]string, len(names))
+			for i := range names {
+				board[i] = fmt.Sprintf("%s: %d", name(i), totals[i])
+			}
+			fmt.Println("Scoreboard → " + strings.Join(board, " | "))
+			fmt.Println("\n" + ColorGreen + name(e.Idx) + "'s turn:" + ColorReset)
+			turnOver = false
+		}
+		if e.Idx >= 0 && e.Idx < len(totals) && (e.T == "score" || e.T == "penalty") {
+			totals[e.Idx] = e.Total
+		}
+
+		switch e.T {
+		case "roll":
+			fmt.Printf("-- %s rolls %d dice --\n", name(e.Idx), len(e.Dice))
+			renderDice(e.Dice)
+		case "keep":
+			fmt.Printf("%s keeps %v gaining %d (turn total %d).\n", name(e.Idx), e.Dice, e.Delta, e.Turn)
+		case "hot":
+			fmt.Println(ColorYellow + "Hot dice! Rolling all 6 again." + ColorReset)
+		case "farkle":
+			fmt.Println(ColorRed + name(e.Idx) + " farkled and scores 0." + ColorReset)
+			turnOver = true
+		case "score":
+			fmt.Printf(ColorGreen+"%s banks %d (total %d)."+ColorReset+"\n", name(e.Idx), e.Delta, e.Total)
+			turnOver = true
+		case "penalty":
+			fmt.Printf(ColorRed+"Third farkle in a row costs %s %d points (total %d)."+ColorReset+"\n", name(e.Idx), -e.Delta, e.Total)
+		case "last_chance":
+			fmt.Printf(ColorYellow+"Final round! %s reached %d."+ColorReset+"\n", name(e.Idx), e.Total)
+		case "forfeit":
+			fmt.Println(ColorRed + name(e.Idx) + " forfeits." + ColorReset)
+		case "rejected":
+			fmt.Printf(ColorRed+"Rejected from %s: keep %v – %s"+ColorReset+"\n", name(e.Idx), e.Keep, e.Text)
+		case "game_over":
+			standings := e.Standings
+			for i := range standings {
+				standings[i].Name = name(standings[i].Idx)
+			}
+			printStandings(standings)
+			fmt.Println("\n" + ColorGreen + name(e.Idx) + " wins." + ColorReset)
+		}
+	}
+	return nil
+}
+
+// waitReplay blocks until Enter; it reports false when the viewer quits.
+func waitReplay() bool {
+	fmt.Print("> ")
+	line, ok := ReadLine()
+	if !ok {
+		return false
+	}
+	in := strings.ToLower(strings.TrimSpace(line))
+	return in != "q" && in != "quit" && in != "exit"
+}
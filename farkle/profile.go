@@ -0,0 +1,348 @@
+package farkle
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// MARK: Profiles
+
+// Profile is a named player with lifetime statistics, stored as JSON under
+// the user config directory.
+type Profile struct {
+	Name string `json:"name"`
+	// Stats is keyed by mode ("solo", "hotseat", "online") and then opponent.
+	Stats map[string]map[string]*Record `json:"stats"`
+}
+
+// Record accumulates one profile's results against one opponent.
+type Record struct {
+	Played      int `json:"played"`
+	Won         int `json:"won"`
+	Turns       int `json:"turns"`
+	Points      int `json:"points"` // banked over all turns
+	Farkles     int `json:"farkles"`
+	HotDice     int `json:"hot_dice"`
+	BiggestTurn int `json:"biggest_turn"`
+}
+
+// AvgTurn is the mean banked score per turn, farkles included.
+func (r *Record) AvgTurn() float64 {
+	if r.Turns == 0 {
+		return 0
+	}
+	return float64(r.Points) / float64(r.Turns)
+}
+
+// FarkleRate is the share of turns that ended in a farkle.
+func (r *Record) FarkleRate() float64 {
+	if r.Turns == 0 {
+		return 0
+	}
+	return float64(r.Farkles) / float64(r.Turns)
+}
+
+func (r *Record) add(o *Record) {
+	r.Played += o.Played
+	r.Won += o.Won
+	r.Turns += o.Turns
+	r.Points += o.Points
+	r.Farkles += o.Farkles
+	r.HotDice += o.HotDice
+	r.BiggestTurn = max(r.BiggestTurn, o.BiggestTurn)
+}
+
+var profileName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,20}$`)
+
+// ValidProfileName reports whether name can be used for a profile.
+func ValidProfileName(name string) bool {
+	return profileName.MatchString(name)
+}
+
+func profileDir() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "farkle", "profiles"), nil
+}
+
+// LoadProfile reads the named profile, returning an empty one if it has
+// never been saved.
+func LoadProfile(name string) (*Profile, error) {
+	if !ValidProfileName(name) {
+		return nil, fmt.Errorf("invalid profile name %q (use up to 20 letters, digits, '-' or '_')", name)
+	}
+	p := &Profile{Name: name, Stats: map[string]map[string]*Record{}}
+	dir, err := profileDir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, name+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return p, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("profile %s: %w", name, err)
+	}
+	if p.Stats == nil {
+		p.Stats = map[string]map[string]*Record{}
+	}
+	return p, nil
+}
+
+// Save writes the profile to disk.
+func (p *Profile) Save() error {
+	dir, err := profileDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, p.Name+".json"), append(data, '\n'), 0o644)
+}
+
+// ListProfiles names every saved profile.
+func ListProfiles() ([]string, error) {
+	dir, err := profileDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, strings.TrimSuffix(filepath.Base(f), ".json"))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// CurrentProfile is the profile selected with 'profile <name>', or "" when
+// none has been chosen.
+func CurrentProfile() string {
+	dir, err := profileDir()
+	if err != nil {
+		return ""
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "current"))
+	if err != nil {
+		return ""
+	}
+	name := strings.TrimSpace(string(data))
+	if !ValidProfileName(name) {
+		return ""
+	}
+	return name
+}
+
+// SetCurrentProfile remembers name as the active profile for later sessions.
+func SetCurrentProfile(name string) error {
+	dir, err := profileDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "current"), []byte(name+"\n"), 0o644)
+}
+
+// Record returns the record for mode and opponent, creating it if needed.
+func (p *Profile) Record(mode, opponent string) *Record {
+	if p.Stats[mode] == nil {
+		p.Stats[mode] = map[string]*Record{}
+	}
+	r := p.Stats[mode][opponent]
+	if r == nil {
+		r = &Record{}
+		p.Stats[mode][opponent] = r
+	}
+	return r
+}
+
+// Total sums every record of the profile.
+func (p *Profile) Total() Record {
+	var t Record
+	for _, opps := range p.Stats {
+		for _, r := range opps {
+			t.add(r)
+		}
+	}
+	return t
+}
+
+// PrintStats shows the profile's records per mode and opponent.
+func (p *Profile) PrintStats() {
+	fmt.Println(ColorCyan + "Stats for " + p.Name + ColorReset)
+	if len(p.Stats) == 0 {
+		fmt.Println("  No games played yet.")
+		return
+	}
+	row := func(label string, r *Record) {
+		won := 0.0
+		if r.Played > 0 {
+			won = 100 * float64(r.Won) / float64(r.Played)
+		}
+		fmt.Printf("  %-22s %4d played %4d won (%3.0f%%)  avg turn %5.0f  farkle %4.1f%%  hot dice %3d  best turn %5d\n",
+			label, r.Played, r.Won, won, r.AvgTurn(), 100*r.FarkleRate(), r.HotDice, r.BiggestTurn)
+	}
+	modes := make([]string, 0, len(p.Stats))
+	for m := range p.Stats {
+		modes = append(modes, m)
+	}
+	sort.Strings(modes)
+	for _, m := range modes {
+		opps := make([]string, 0, len(p.Stats[m]))
+		for o := range p.Stats[m] {
+			opps = append(opps, o)
+		}
+		sort.Strings(opps)
+		for _, o := range opps {
+			row(m+" vs "+o, p.Stats[m][o])
+		}
+	}
+	total := p.Total()
+	row("all games", &total)
+}
+
+// MARK: Stats tracking
+
+// StatsTracker counts one game for the player in Seat and saves the result
+// into the profile when the game ends. It is a Recorder for local games;
+// networked peers feed it the messages they receive.
+type StatsTracker struct {
+	Profile  *Profile
+	Mode     string
+	Opponent string
+	Seat     int
+	bound    bool
+	game     Record
+}
+
+// Track starts counting a game played from seat against opponent. For local
+// games an empty mode, empty opponent or negative seat is worked out from
+// the game itself, finding the seat by the profile's name.
+func (p *Profile) Track(mode, opponent string, seat int) *StatsTracker {
+	return &StatsTracker{Profile: p, Mode: mode, Opponent: opponent, Seat: seat}
+}
+
+// Record implements Recorder.
+func (s *StatsTracker) Record(g *Game, events []Event) {
+	if !s.bound {
+		s.bind(g)
+	}
+	if s.Seat < 0 {
+		return // the profile is not playing in this game
+	}
+	for _, ev := range events {
+		if msg, ok := eventMsg(g, ev); ok {
+			s.Message(msg)
+		}
+	}
+}
+
+func (s *StatsTracker) bind(g *Game) {
+	s.bound = true
+	if s.Seat < 0 {
+		for i, p := range g.Players {
+			if p.Bot == nil && p.Name == s.Profile.Name {
+				s.Seat = i
+			}
+		}
+	}
+	if s.Mode == "" {
+		s.Mode = "solo"
+		if humans(g) > 1 {
+			s.Mode = "hotseat"
+		}
+	}
+	if s.Opponent == "" {
+		var opps []string
+		for i, p := range g.Players {
+			switch {
+			case i == s.Seat:
+			case p.Bot != nil:
+				opps = append(opps, p.Bot.Name())
+			default:
+				opps = append(opps, p.Name)
+			}
+		}
+		s.Opponent = strings.Join(opps, ",")
+	}
+}
+
+// Message counts one event message. A nil tracker is a no-op.
+func (s *StatsTracker) Message(msg NetMsg) {
+	if s == nil {
+		return
+	}
+	if msg.T == "game_over" {
+		s.game.Played = 1
+		if msg.Idx == s.Seat {
+			s.game.Won = 1
+		}
+		s.Profile.Record(s.Mode, s.Opponent).add(&s.game)
+		s.game = Record{}
+		if err := s.Profile.Save(); err != nil {
+			fmt.Println(ColorRed + "Could not save profile: " + err.Error() + ColorReset)
+		}
+		return
+	}
+	if msg.Idx != s.Seat {
+		return
+	}
+	switch msg.T {
+	case "farkle":
+		s.game.Turns++
+		s.game.Farkles++
+	case "hot":
+		s.game.HotDice++
+	case "score":
+		s.game.Turns++
+		s.game.Points += msg.Delta
+		s.game.BiggestTurn = max(s.game.BiggestTurn, msg.Delta)
+	}
+}
+
+// Recorders combines several recorders, skipping nil ones.
+func Recorders(rs ...Recorder) Recorder {
+	var out multiRecorder
+	for _, r := range rs {
+		if r != nil {
+			out = append(out, r)
+		}
+	}
+	switch len(out) {
+	case 0:
+		return nil
+	case 1:
+		return out[0]
+	}
+	return out
+}
+
+type multiRecorder []Recorder
+
+func (m multiRecorder) Record(g *Game, events []Event) {
+	for _, r := range m {
+		r.Record(g, events)
+	}
+}
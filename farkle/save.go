@@ -0,0 +1,173 @@
+package farkle
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// MARK: Save files
+
+// saveVersion is bumped whenever the snapshot layout changes incompatibly.
+const saveVersion = 1
+
+// ErrSaveVersion is returned when a save file was written by an incompatible
+// version of the game.
+var ErrSaveVersion = errors.New("unsupported save file version")
+
+// Snapshot is the versioned JSON form of a game in progress.
+type Snapshot struct {
+	Version int       `json:"version"`
+	Saved   time.Time `json:"saved"`
+
+	Target        int           `json:"target"`
+	Rules         *ScoringRules `json:"rules"`
+	OpeningScore  int           `json:"opening,omitempty"`
+	FarklePenalty int           `json:"penalty,omitempty"`
+	FinalRound    bool          `json:"final,omitempty"`
+	Dice          DiceState     `json:"dice"`
+
+	Players    []SavedPlayer `json:"players"`
+	Round      int           `json:"round"`
+	Turn       SavedTurn     `json:"turn"`
+	LastChance bool          `json:"last_chance,omitempty"`
+	Closer     int           `json:"closer,omitempty"`
+}
+
+// SavedPlayer is one seat of a Snapshot; AI names the strategy of a
+// computer player and is empty for humans.
+type SavedPlayer struct {
+	Name         string `json:"name"`
+	Total        int    `json:"total"`
+	OnBoard      bool   `json:"on_board,omitempty"`
+	FarkleStreak int    `json:"farkle_streak,omitempty"`
+	Out          bool   `json:"out,omitempty"`
+	AI           string `json:"ai,omitempty"`
+}
+
+// SavedTurn is the turn in progress, including a roll awaiting a keep.
+type SavedTurn struct {
+	Idx      int   `json:"idx"`
+	Score    int   `json:"score"`
+	DiceLeft int   `json:"dice_left"`
+	Roll     []int `json:"roll,omitempty"`
+}
+
+// Snapshot captures everything needed to resume g exactly where it is.
+func (g *Game) Snapshot() (*Snapshot, error) {
+	if g.Over {
+		return nil, ErrGameOver
+	}
+	dice, err := SnapshotDice(g.Dice)
+	if err != nil {
+		return nil, err
+	}
+	s := &Snapshot{
+		Version:       saveVersion,
+		Saved:         time.Now().UTC(),
+		Target:        g.Target,
+		Rules:         g.Rules,
+		OpeningScore:  g.OpeningScore,
+		FarklePenalty: g.FarklePenalty,
+		FinalRound:    g.FinalRound,
+		Dice:          dice,
+		Round:         g.Round,
+		Turn:          SavedTurn(g.Turn),
+		LastChance:    g.LastChance,
+		Closer:        g.Closer,
+	}
+	for _, p := range g.Players {
+		sp := SavedPlayer{Name: p.Name, Total: p.Total, OnBoard: p.OnBoard, FarkleStreak: p.FarkleStreak, Out: p.Out}
+		if p.Bot != nil {
+			sp.AI = p.Bot.Name()
+		}
+		s.Players = append(s.Players, sp)
+	}
+	return s, nil
+}
+
+// Restore rebuilds the game a Snapshot was taken from.
+func (s *Snapshot) Restore() (*Game, error) {
+	if s.Version != saveVersion {
+		return nil, fmt.Errorf("%w %d (want %d)", ErrSaveVersion, s.Version, saveVersion)
+	}
+	if s.Rules == nil || len(s.Players) < 2 {
+		return nil, fmt.Errorf("save file is incomplete")
+	}
+	if err := s.Rules.validate(); err != nil {
+		return nil, err
+	}
+	dice, err := s.Dice.Restore()
+	if err != nil {
+		return nil, err
+	}
+	t := s.Turn
+	if t.Idx < 0 || t.Idx >= len(s.Players) || t.DiceLeft < 1 || t.DiceLeft > 6 || len(t.Roll) > t.DiceLeft {
+		return nil, fmt.Errorf("save file has an invalid turn")
+	}
+
+	g := NewGame(Options{
+		Target:        s.Target,
+		Rules:         presetOr(s.Rules),
+		Dice:          dice,
+		OpeningScore:  s.OpeningScore,
+		FarklePenalty: s.FarklePenalty,
+		FinalRound:    s.FinalRound,
+	})
+	for _, sp := range s.Players {
+		p := Player{Name: sp.Name, Total: sp.Total, OnBoard: sp.OnBoard, FarkleStreak: sp.FarkleStreak, Out: sp.Out}
+		if sp.AI != "" {
+			if p.Bot, err = NewStrategy(sp.AI); err != nil {
+				return nil, err
+			}
+		}
+		g.Players = append(g.Players, p)
+	}
+	g.Round = s.Round
+	g.Turn = TurnState(t)
+	g.LastChance = s.LastChance
+	g.Closer = s.Closer
+	return g, nil
+}
+
+// presetOr returns the built-in preset identical to r, so resumed games share
+// the cached hint and policy tables, or r itself for custom rules.
+func presetOr(r *ScoringRules) *ScoringRules {
+	if p, ok := Presets[r.Name]; ok {
+		a, _ := json.Marshal(p)
+		b, _ := json.Marshal(r)
+		if bytes.Equal(a, b) {
+			return p
+		}
+	}
+	return r
+}
+
+// SaveGame writes g to path as a Snapshot.
+func SaveGame(g *Game, path string) error {
+	s, err := g.Snapshot()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// LoadGame reads a game saved by SaveGame.
+func LoadGame(path string) (*Game, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s Snapshot
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return s.Restore()
+}
@@ -0,0 +1,399 @@
+package farkle
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+)
+
+// MARK: Scoring rules
+
+// N-of-a-kind modes for ScoringRules.Kind.
+const (
+	KindDoubling = "doubling" // each die past three doubles the triple
+	KindAdditive = "additive" // each die past three adds the triple again
+	KindFlat     = "flat"     // FourKind / FiveKind / SixKind fixed values
+)
+
+// ScoringRules is a declarative house-rule set. A zero combination value
+// disables that combination.
+type ScoringRules struct {
+	Name string `json:"name" toml:"name"`
+
+	One        int `json:"one" toml:"one"`
+	Five       int `json:"five" toml:"five"`
+	TripleOnes int `json:"triple_ones" toml:"triple_ones"`
+	TripleFace int `json:"triple_face" toml:"triple_face"` // triple of N scores N × TripleFace
+
+	Kind     string `json:"kind" toml:"kind"`
+	FourKind int    `json:"four_kind,omitempty" toml:"four_kind"`
+	FiveKind int    `json:"five_kind,omitempty" toml:"five_kind"`
+	SixKind  int    `json:"six_kind,omitempty" toml:"six_kind"`
+
+	// A 1-5 or 2-6 straight only scores when it is all of the dice kept.
+	Straight15 int `json:"straight_1_5,omitempty" toml:"straight_1_5"`
+	Straight26 int `json:"straight_2_6,omitempty" toml:"straight_2_6"`
+	Straight16 int `json:"straight_1_6,omitempty" toml:"straight_1_6"`
+
+	ThreePairs   int `json:"three_pairs,omitempty" toml:"three_pairs"`
+	TwoTriplets  int `json:"two_triplets,omitempty" toml:"two_triplets"`
+	FourKindPair int `json:"four_kind_pair,omitempty" toml:"four_kind_pair"`
+
+	once  sync.Once
+	table map[int]scoreEntry
+	alone []combo // combinations that never share a keep with other dice
+}
+
+// Presets are the built-in rule sets, looked up by name.
+var Presets = map[string]*ScoringRules{
+	"classic": ClassicRules,
+	"zilch": {
+		Name: "zilch", One: 100, Five: 50, TripleOnes: 1000, TripleFace: 100,
+		Kind: KindAdditive, Straight16: 1500, ThreePairs: 1500,
+	},
+	"farkle-10000": {
+		Name: "farkle-10000", One: 100, Five: 50, TripleOnes: 300, TripleFace: 100,
+		Kind: KindFlat, FourKind: 1000, FiveKind: 2000, SixKind: 3000,
+		Straight16: 1500, ThreePairs: 1500, TwoTriplets: 2500, FourKindPair: 1500,
+	},
+}
+
+// ClassicRules is the original house rule: doubling N-of-a-kind and
+// 1-5 / 2-6 / 1-6 straights.
+var ClassicRules = &ScoringRules{
+	Name: "classic", One: 100, Five: 50, TripleOnes: 1000, TripleFace: 100,
+	Kind: KindDoubling, Straight15: 500, Straight26: 750, Straight16: 1500,
+}
+
+// LoadRules resolves a preset name or reads a .toml / .json rule file.
+func LoadRules(nameOrPath string) (*ScoringRules, error) {
+	if r, ok := Presets[strings.ToLower(nameOrPath)]; ok {
+		return r, nil
+	}
+	data, err := os.ReadFile(nameOrPath)
+	if err != nil {
+		return nil, fmt.Errorf("unknown rule preset or file %q", nameOrPath)
+	}
+	r := &ScoringRules{}
+	if strings.EqualFold(filepath.Ext(nameOrPath), ".toml") {
+		err = toml.Unmarshal(data, r)
+	} else {
+		err = json.Unmarshal(data, r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading rules %s: %w", nameOrPath, err)
+	}
+	if r.Name == "" {
+		r.Name = strings.TrimSuffix(filepath.Base(nameOrPath), filepath.Ext(nameOrPath))
+	}
+	return r, r.validate()
+}
+
+func (r *ScoringRules) validate() error {
+	switch r.Kind {
+	case KindDoubling, KindAdditive, KindFlat:
+	case "":
+		r.Kind = KindDoubling
+	default:
+		return fmt.Errorf("rules %s: unknown kind %q", r.Name, r.Kind)
+	}
+	if r.One <= 0 && r.Five <= 0 && r.TripleOnes <= 0 && r.TripleFace <= 0 {
+		return fmt.Errorf("rules %s: no scoring combinations", r.Name)
+	}
+	return nil
+}
+
+// MARK: Scoring
+
+// Score returns the best points the dice can make; dice that are not part
+// of any combination are ignored.
+func (r *ScoringRules) Score(dice []int) int {
+	return r.lookup(dice).points
+}
+
+// KeepScore scores dice as a keep: 0 unless every die is part of a
+// scoring combination.
+func (r *ScoringRules) KeepScore(dice []int) int {
+	if len(r.Dead(dice)) > 0 {
+		return 0
+	}
+	return r.Score(dice)
+}
+
+// Best returns the dice of roll that make up its highest-scoring keep.
+func (r *ScoringRules) Best(roll []int) (kept []int, points int) {
+	e := r.lookup(roll)
+	used, points := e.used, e.points
+	var c [7]int
+	for _, d := range roll {
+		if d >= 1 && d <= 6 {
+			c[d]++
+		}
+	}
+	for _, cb := range r.alone {
+		if _, ok := subtract(c, cb.counts); ok && cb.points > points {
+			used, points = cb.counts, cb.points
+		}
+	}
+	for face := 1; face <= 6; face++ {
+		for i := 0; i < used[face]; i++ {
+			kept = append(kept, face)
+		}
+	}
+	return kept, points
+}
+
+// Dead returns the dice that cannot take part in any scoring combination
+// alongside the others, in ascending order.
+func (r *ScoringRules) Dead(dice []int) []int {
+	e := r.lookup(dice)
+	var c [7]int
+	for _, d := range dice {
+		if d >= 1 && d <= 6 {
+			c[d]++
+		}
+	}
+	var dead []int
+	for face := 1; face <= 6; face++ {
+		for i := e.cover[face]; i < c[face]; i++ {
+			dead = append(dead, face)
+		}
+	}
+	return dead
+}
+
+// scoreEntry is the best partition of a dice multiset into combinations.
+type scoreEntry struct {
+	points int
+	used   [7]int // dice per face that take part in the combinations
+	cover  [7]int // dice per face of the partition that leaves fewest dice out
+}
+
+type combo struct {
+	counts [7]int
+	points int
+	alone  bool
+}
+
+func (r *ScoringRules) lookup(dice []int) scoreEntry {
+	r.once.Do(r.build)
+	var c [7]int
+	for _, d := range dice {
+		if d < 1 || d > 6 {
+			return scoreEntry{}
+		}
+		c[d]++
+	}
+	return r.table[countsKey(c)]
+}
+
+func countsKey(c [7]int) int {
+	k := 0
+	for face := 1; face <= 6; face++ {
+		k = k*7 + c[face]
+	}
+	return k
+}
+
+// build precomputes the best partition of every multiset of up to six dice.
+// Combinations marked alone only count when they are the whole multiset.
+func (r *ScoringRules) build() {
+	var combos []combo
+	for _, cb := range r.combos() {
+		if cb.alone {
+			r.alone = append(r.alone, cb)
+		} else {
+			combos = append(combos, cb)
+		}
+	}
+	memo := make(map[int]scoreEntry)
+	var solve func(c [7]int) scoreEntry
+	solve = func(c [7]int) scoreEntry {
+		key := countsKey(c)
+		if e, ok := memo[key]; ok {
+			return e
+		}
+		var best scoreEntry
+		for _, cb := range combos {
+			rest, ok := subtract(c, cb.counts)
+			if !ok {
+				continue
+			}
+			e := solve(rest)
+			e.points += cb.points
+			for face := 1; face <= 6; face++ {
+				e.used[face] += cb.counts[face]
+				e.cover[face] += cb.counts[face]
+			}
+			if e.points > best.points || (e.points == best.points && diceIn(e.used) > diceIn(best.used)) {
+				best.points, best.used = e.points, e.used
+			}
+			if diceIn(e.cover) > diceIn(best.cover) {
+				best.cover = e.cover
+			}
+		}
+		memo[key] = best
+		return best
+	}
+	r.table = make(map[int]scoreEntry)
+	var walk func(face, left int, c [7]int)
+	walk = func(face, left int, c [7]int) {
+		if face > 6 {
+			e := solve(c)
+			for _, cb := range r.alone {
+				if cb.counts != c {
+					continue
+				}
+				e.cover = c
+				if cb.points > e.points {
+					e.points, e.used = cb.points, c
+				}
+			}
+			r.table[countsKey(c)] = e
+			return
+		}
+		for n := 0; n <= left; n++ {
+			c[face] = n
+			walk(face+1, left-n, c)
+		}
+	}
+	walk(1, 6, [7]int{})
+}
+
+func (r *ScoringRules) combos() []combo {
+	var out []combo
+	add := func(points int, faces ...int) {
+		if points <= 0 {
+			return
+		}
+		var c [7]int
+		for _, f := range faces {
+			c[f]++
+		}
+		out = append(out, combo{counts: c, points: points})
+	}
+	add(r.One, 1)
+	add(r.Five, 5)
+	for face := 1; face <= 6; face++ {
+		for n := 3; n <= 6; n++ {
+			add(r.kindValue(face, n), repeat(face, n)...)
+		}
+	}
+	n := len(out)
+	add(r.Straight15, 1, 2, 3, 4, 5)
+	add(r.Straight26, 2, 3, 4, 5, 6)
+	for i := n; i < len(out); i++ {
+		out[i].alone = true
+	}
+	add(r.Straight16, 1, 2, 3, 4, 5, 6)
+	for a := 1; a <= 6; a++ {
+		for b := 1; b <= 6; b++ {
+			if a == b {
+				continue
+			}
+			add(r.FourKindPair, append(repeat(a, 4), b, b)...)
+			if a < b {
+				add(r.TwoTriplets, append(repeat(a, 3), repeat(b, 3)...)...)
+			}
+			for c := b + 1; c <= 6; c++ {
+				if a < b {
+					add(r.ThreePairs, a, a, b, b, c, c)
+				}
+			}
+		}
+	}
+	return out
+}
+
+func (r *ScoringRules) kindValue(face, n int) int {
+	triple := face * r.TripleFace
+	if face == 1 {
+		triple = r.TripleOnes
+	}
+	if n == 3 || triple <= 0 {
+		return triple
+	}
+	switch r.Kind {
+	case KindFlat:
+		return [...]int{4: r.FourKind, 5: r.FiveKind, 6: r.SixKind}[n]
+	case KindAdditive:
+		return triple * (n - 2)
+	default:
+		return triple << (n - 3)
+	}
+}
+
+// Describe lists the enabled combinations and their values.
+func (r *ScoringRules) Describe() []string {
+	var lines []string
+	line := func(label string, v int) {
+		if v > 0 {
+			lines = append(lines, fmt.Sprintf("%-22s %d", label, v))
+		}
+	}
+	line("Single 1", r.One)
+	line("Single 5", r.Five)
+	line("Three 1s", r.TripleOnes)
+	if r.TripleFace > 0 {
+		lines = append(lines, fmt.Sprintf("%-22s %d – %d", "Three 2s … 6s", 2*r.TripleFace, 6*r.TripleFace))
+	}
+	switch r.Kind {
+	case KindFlat:
+		line("4-of-a-kind", r.FourKind)
+		line("5-of-a-kind", r.FiveKind)
+		line("6-of-a-kind", r.SixKind)
+	case KindAdditive:
+		lines = append(lines, fmt.Sprintf("%-22s %s", "4/5/6-of-a-kind", "×2 / ×3 / ×4 triple"))
+	default:
+		lines = append(lines, fmt.Sprintf("%-22s %s", "4/5/6-of-a-kind", "×2 / ×4 / ×8 triple"))
+	}
+	line("Straight 1-5", r.Straight15)
+	line("Straight 2-6", r.Straight26)
+	line("Straight 1-6", r.Straight16)
+	line("Three pairs", r.ThreePairs)
+	line("Two triplets", r.TwoTriplets)
+	line("4-of-a-kind + pair", r.FourKindPair)
+	return lines
+}
+
+// PresetNames returns the built-in preset names in a stable order.
+func PresetNames() []string {
+	names := make([]string, 0, len(Presets))
+	for n := range Presets {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func subtract(c, sub [7]int) ([7]int, bool) {
+	for face := 1; face <= 6; face++ {
+		if sub[face] > c[face] {
+			return c, false
+		}
+		c[face] -= sub[face]
+	}
+	return c, true
+}
+
+func diceIn(c [7]int) int {
+	n := 0
+	for _, v := range c {
+		n += v
+	}
+	return n
+}
+
+func repeat(face, n int) []int {
+	out := make([]int, n)
+	for i := range out {
+		out[i] = face
+	}
+	return out
+}
@@ -0,0 +1,138 @@
+package farkle
+
+import (
+	"fmt"
+	"testing"
+)
+
+// baselineScore is calculateScore as it stood before ScoringRules; the
+// classic preset must keep scoring exactly like it.
+func baselineScore(dice []int) int {
+	counts := make(map[int]int)
+	for _, d := range dice {
+		counts[d]++
+	}
+
+	if len(dice) == 6 {
+		full := true
+		for i := 1; i <= 6; i++ {
+			if counts[i] != 1 {
+				full = false
+				break
+			}
+		}
+		if full {
+			return 1500
+		}
+	}
+
+	if len(dice) == 5 {
+		isStraight15 := true
+		for i := 1; i <= 5; i++ {
+			if counts[i] != 1 {
+				isStraight15 = false
+				break
+			}
+		}
+		if isStraight15 {
+			return 500
+		}
+		isStraight26 := true
+		for i := 2; i <= 6; i++ {
+			if counts[i] != 1 {
+				isStraight26 = false
+				break
+			}
+		}
+		if isStraight26 {
+			return 750
+		}
+	}
+
+	score := 0
+	for val, cnt := range counts {
+		if cnt >= 3 {
+			base := 0
+			if val == 1 {
+				base = 1000
+			} else {
+				base = val * 100
+			}
+			mult := 1 << (cnt - 3)
+			score += base * mult
+			cnt = 0
+		}
+		if val == 1 {
+			score += cnt * 100
+		} else if val == 5 {
+			score += cnt * 50
+		}
+	}
+	return score
+}
+
+// multisets returns every sorted multiset of n dice.
+func multisets(n int) [][]int {
+	var out [][]int
+	var walk func(from int, dice []int)
+	walk = func(from int, dice []int) {
+		if len(dice) == n {
+			out = append(out, append([]int(nil), dice...))
+			return
+		}
+		for face := from; face <= 6; face++ {
+			walk(face, append(dice, face))
+		}
+	}
+	walk(1, nil)
+	return out
+}
+
+func TestClassicMatchesBaseline(t *testing.T) {
+	for n := 1; n <= 6; n++ {
+		for _, dice := range multisets(n) {
+			if got, want := ClassicRules.Score(dice), baselineScore(dice); got != want {
+				t.Errorf("Score(%v) = %d, baseline %d", dice, got, want)
+			}
+		}
+	}
+}
+
+func TestClassicStraights(t *testing.T) {
+	tests := []struct {
+		dice       []int
+		score      int
+		best       []int
+		bestPoints int
+	}{
+		{[]int{1, 2, 3, 4, 5}, 500, []int{1, 2, 3, 4, 5}, 500},
+		{[]int{2, 3, 4, 5, 6}, 750, []int{2, 3, 4, 5, 6}, 750},
+		{[]int{1, 2, 3, 4, 5, 6}, 1500, []int{1, 2, 3, 4, 5, 6}, 1500},
+		{[]int{1, 1, 2, 3, 4, 5}, 250, []int{1, 2, 3, 4, 5}, 500},
+		{[]int{2, 3, 4, 5, 5, 6}, 100, []int{2, 3, 4, 5, 6}, 750},
+		{[]int{1, 2, 3, 4, 5, 5}, 200, []int{1, 2, 3, 4, 5}, 500},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.dice), func(t *testing.T) {
+			if got := ClassicRules.Score(tt.dice); got != tt.score {
+				t.Errorf("Score = %d, want %d", got, tt.score)
+			}
+			kept, points := ClassicRules.Best(tt.dice)
+			if fmt.Sprint(kept) != fmt.Sprint(tt.best) || points != tt.bestPoints {
+				t.Errorf("Best = %v %d, want %v %d", kept, points, tt.best, tt.bestPoints)
+			}
+		})
+	}
+}
+
+func TestStraightKeptAlone(t *testing.T) {
+	if dead := ClassicRules.Dead([]int{1, 2, 3, 4, 5}); len(dead) != 0 {
+		t.Errorf("Dead(1-5) = %v, want none", dead)
+	}
+	if err := ClassicRules.ValidateKeep([]int{1, 1, 2, 3, 4, 5}, []int{1, 1, 2, 3, 4, 5}); err == nil {
+		t.Error("ValidateKeep accepted a straight with an extra die")
+	}
+	if err := ClassicRules.ValidateKeep([]int{1, 1, 2, 3, 4, 5}, []int{1, 2, 3, 4, 5}); err != nil {
+		t.Errorf("ValidateKeep(1-5) = %v", err)
+	}
+}
@@ -0,0 +1,326 @@
+package farkle
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	crand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// MARK: Secure channel
+
+// Every connection starts with a handshake keyed by the secret in the lobby
+// ID, so only someone who was given the ID can join, and the joiner knows it
+// reached the real host:
+//
+//	client → host   "FKL1" ‖ client nonce
+//	host → client   host nonce ‖ HMAC(secret, "farkle host" ‖ nonces)
+//	client → host   HMAC(secret, "farkle client" ‖ nonces)
+//
+// Each side checks the other's MAC before sending anything else. The
+// session then runs over AES-256-GCM frames, one key per direction derived
+// from the secret and both nonces, with the frame counter as the nonce. The
+// secret is random and long enough that guessing it from a recorded
+// handshake is out of reach, so a plain pre-shared key does the job a PAKE
+// would do for a short password.
+//
+// A player who found a listed lobby on the local network pairs instead,
+// without the secret:
+//
+//	client → host   "FKP1" ‖ SHA-256(client X25519 key)
+//	host → client   host X25519 key
+//	client → host   client X25519 key
+//
+// The frames are keyed by the X25519 shared secret, and both sides show a
+// six-digit code derived from the two keys. The host admits the player only
+// after typing the code the player sees, which no one in the middle can
+// arrange to match: the client is bound to its key before it sees the
+// host's, and the host has sent its key before it learns the client's.
+
+const (
+	secretBytes    = 10 // 80-bit lobby secret
+	nonceBytes     = 32
+	maxFrame       = 1 << 20
+	handshakeMagic = "FKL1"
+	pairMagic      = "FKP1"
+	pairCodeDigits = 6
+	handshakeLimit = 10 * time.Second
+)
+
+// ErrAuth means the other side does not hold the lobby secret.
+var ErrAuth = errors.New("authentication failed")
+
+// ErrPlaintext means the client skipped the handshake and opened with a
+// JSON message, as clients from before the secure channel do.
+var ErrPlaintext = errors.New("client sent plain JSON")
+
+// newLobbySecret picks the secret a lobby ID carries.
+func newLobbySecret() []byte {
+	secret := make([]byte, secretBytes)
+	if _, err := crand.Read(secret); err != nil {
+		panic("farkle: crypto/rand unavailable: " + err.Error())
+	}
+	return secret
+}
+
+// serverHandshake authenticates a joining client on conn and returns the
+// encrypted connection. Clients without the secret get ErrAuth and never
+// see a game message. A client whose first byte opens a JSON object gets
+// ErrPlaintext after that one byte, so the caller can read its hello and
+// tell it why it cannot join. If pairing is set, a client may pair instead;
+// the returned code is then the one the host must confirm, and "" otherwise.
+func serverHandshake(conn net.Conn, secret []byte, pairing bool) (net.Conn, string, error) {
+	conn.SetDeadline(time.Now().Add(handshakeLimit))
+	defer conn.SetDeadline(time.Time{})
+
+	hello := make([]byte, len(handshakeMagic)+nonceBytes)
+	if _, err := io.ReadFull(conn, hello[:1]); err != nil {
+		return nil, "", err
+	}
+	if hello[0] == '{' {
+		return nil, "", ErrPlaintext
+	}
+	if _, err := io.ReadFull(conn, hello[1:]); err != nil {
+		return nil, "", err
+	}
+	switch string(hello[:len(handshakeMagic)]) {
+	case handshakeMagic:
+	case pairMagic:
+		if !pairing {
+			return nil, "", fmt.Errorf("%w: pairing is only open to listed lobbies on the local network", ErrAuth)
+		}
+		return servePairing(conn, hello[len(pairMagic):])
+	default:
+		return nil, "", fmt.Errorf("%w: not a farkle client", ErrAuth)
+	}
+	cn := hello[len(handshakeMagic):]
+	hn := randomNonce()
+	if _, err := conn.Write(append(hn, authTag(secret, "farkle host", cn, hn)...)); err != nil {
+		return nil, "", err
+	}
+	tag := make([]byte, sha256.Size)
+	if _, err := io.ReadFull(conn, tag); err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrAuth, err)
+	}
+	if !hmac.Equal(tag, authTag(secret, "farkle client", cn, hn)) {
+		return nil, "", ErrAuth
+	}
+	conn, err := newSecureConn(conn, secret, cn, hn, "host→client", "client→host")
+	return conn, "", err
+}
+
+// servePairing is the host's side of pairing, once the client has sent the
+// hash of its key.
+func servePairing(conn net.Conn, commitment []byte) (net.Conn, string, error) {
+	key := newPairKey()
+	hk := key.PublicKey().Bytes()
+	if _, err := conn.Write(hk); err != nil {
+		return nil, "", err
+	}
+	ck := make([]byte, len(hk))
+	if _, err := io.ReadFull(conn, ck); err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrAuth, err)
+	}
+	if sum := sha256.Sum256(ck); !hmac.Equal(sum[:], commitment) {
+		return nil, "", fmt.Errorf("%w: the pairing key does not match its commitment", ErrAuth)
+	}
+	return pairedConn(conn, key, ck, ck, hk, "host→client", "client→host")
+}
+
+// pairHandshake pairs with the host on conn, for a player who has no lobby
+// ID, and returns the encrypted connection and the code the host must
+// confirm before it lets the player in.
+func pairHandshake(conn net.Conn) (net.Conn, string, error) {
+	conn.SetDeadline(time.Now().Add(handshakeLimit))
+	defer conn.SetDeadline(time.Time{})
+
+	key := newPairKey()
+	ck := key.PublicKey().Bytes()
+	sum := sha256.Sum256(ck)
+	if _, err := conn.Write(append([]byte(pairMagic), sum[:]...)); err != nil {
+		return nil, "", err
+	}
+	hk := make([]byte, len(ck))
+	if _, err := io.ReadFull(conn, hk); err != nil {
+		return nil, "", fmt.Errorf("%w: the host closed the connection (is the lobby still listed?)", ErrAuth)
+	}
+	if _, err := conn.Write(ck); err != nil {
+		return nil, "", err
+	}
+	return pairedConn(conn, key, hk, ck, hk, "client→host", "host→client")
+}
+
+func newPairKey() *ecdh.PrivateKey {
+	key, err := ecdh.X25519().GenerateKey(crand.Reader)
+	if err != nil {
+		panic("farkle: crypto/rand unavailable: " + err.Error())
+	}
+	return key
+}
+
+// pairedConn completes pairing: it agrees the shared secret with the other
+// side's key, derives the code from both keys and opens the encrypted
+// connection, with the keys standing in for the nonces.
+func pairedConn(conn net.Conn, key *ecdh.PrivateKey, other, ck, hk []byte, sendLabel, recvLabel string) (net.Conn, string, error) {
+	pub, err := ecdh.X25519().NewPublicKey(other)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrAuth, err)
+	}
+	shared, err := key.ECDH(pub)
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrAuth, err)
+	}
+	sc, err := newSecureConn(conn, shared, ck, hk, sendLabel, recvLabel)
+	if err != nil {
+		return nil, "", err
+	}
+	return sc, pairCode(ck, hk), nil
+}
+
+// pairCode is the code both sides of a pairing show.
+func pairCode(ck, hk []byte) string {
+	h := sha256.New()
+	h.Write([]byte("farkle pairing code"))
+	h.Write(ck)
+	h.Write(hk)
+	n := binary.BigEndian.Uint64(h.Sum(nil))
+	mod := uint64(1)
+	for i := 0; i < pairCodeDigits; i++ {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", pairCodeDigits, n%mod)
+}
+
+// clientHandshake proves to the host on conn that we hold secret, checks
+// that the host does too, and returns the encrypted connection.
+func clientHandshake(conn net.Conn, secret []byte) (net.Conn, error) {
+	conn.SetDeadline(time.Now().Add(handshakeLimit))
+	defer conn.SetDeadline(time.Time{})
+
+	cn := randomNonce()
+	if _, err := conn.Write(append([]byte(handshakeMagic), cn...)); err != nil {
+		return nil, err
+	}
+	reply := make([]byte, nonceBytes+sha256.Size)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, fmt.Errorf("%w: the host closed the connection (wrong lobby ID?)", ErrAuth)
+	}
+	hn := reply[:nonceBytes]
+	if !hmac.Equal(reply[nonceBytes:], authTag(secret, "farkle host", cn, hn)) {
+		return nil, fmt.Errorf("%w: the host does not know this lobby's secret (wrong lobby ID?)", ErrAuth)
+	}
+	if _, err := conn.Write(authTag(secret, "farkle client", cn, hn)); err != nil {
+		return nil, err
+	}
+	return newSecureConn(conn, secret, cn, hn, "client→host", "host→client")
+}
+
+func randomNonce() []byte {
+	n := make([]byte, nonceBytes)
+	if _, err := crand.Read(n); err != nil {
+		panic("farkle: crypto/rand unavailable: " + err.Error())
+	}
+	return n
+}
+
+// authTag is HMAC-SHA256 of label and both nonces under secret; it doubles
+// as the key derivation for each direction's cipher.
+func authTag(secret []byte, label string, cn, hn []byte) []byte {
+	m := hmac.New(sha256.New, secret)
+	m.Write([]byte(label))
+	m.Write(cn)
+	m.Write(hn)
+	return m.Sum(nil)
+}
+
+// secureConn frames every Write as one sealed AES-GCM record and decrypts
+// records on Read. Deadlines and Close pass through to the TCP connection.
+type secureConn struct {
+	net.Conn
+	wmu     sync.Mutex
+	send    cipher.AEAD
+	sendSeq uint64
+	recv    cipher.AEAD
+	recvSeq uint64
+	buf     []byte // decrypted bytes not yet read
+}
+
+func newSecureConn(conn net.Conn, secret, cn, hn []byte, sendLabel, recvLabel string) (*secureConn, error) {
+	send, err := newAEAD(authTag(secret, sendLabel, cn, hn))
+	if err != nil {
+		return nil, err
+	}
+	recv, err := newAEAD(authTag(secret, recvLabel, cn, hn))
+	if err != nil {
+		return nil, err
+	}
+	return &secureConn{Conn: conn, send: send, recv: recv}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func seqNonce(aead cipher.AEAD, seq uint64) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	binary.BigEndian.PutUint64(nonce[len(nonce)-8:], seq)
+	return nonce
+}
+
+// Write seals p as a single frame: a 4-byte length, then the ciphertext.
+func (c *secureConn) Write(p []byte) (int, error) {
+	if len(p) > maxFrame {
+		return 0, fmt.Errorf("frame of %d bytes is too large", len(p))
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	frame := make([]byte, 4, 4+len(p)+c.send.Overhead())
+	frame = c.send.Seal(frame, seqNonce(c.send, c.sendSeq), p, nil)
+	binary.BigEndian.PutUint32(frame, uint32(len(frame)-4))
+	c.sendSeq++
+	if _, err := c.Conn.Write(frame); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Read returns decrypted bytes, opening the next frame when needed. A frame
+// that fails to authenticate ends the connection with ErrAuth.
+func (c *secureConn) Read(p []byte) (int, error) {
+	for len(c.buf) == 0 {
+		var hdr [4]byte
+		if _, err := io.ReadFull(c.Conn, hdr[:]); err != nil {
+			return 0, err
+		}
+		n := binary.BigEndian.Uint32(hdr[:])
+		if n > maxFrame+uint32(c.recv.Overhead()) {
+			return 0, fmt.Errorf("%w: oversized frame", ErrAuth)
+		}
+		frame := make([]byte, n)
+		if _, err := io.ReadFull(c.Conn, frame); err != nil {
+			return 0, err
+		}
+		plain, err := c.recv.Open(frame[:0], seqNonce(c.recv, c.recvSeq), frame, nil)
+		if err != nil {
+			return 0, fmt.Errorf("%w: tampered frame", ErrAuth)
+		}
+		c.recvSeq++
+		c.buf = plain
+	}
+	n := copy(p, c.buf)
+	c.buf = c.buf[n:]
+	return n, nil
+}
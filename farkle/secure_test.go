@@ -0,0 +1,232 @@
+package farkle
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+// handshake runs both sides of the handshake over a pipe.
+func handshake(hostSecret, clientSecret []byte) (host, client net.Conn, hostErr, clientErr error) {
+	a, b := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		host, _, hostErr = serverHandshake(a, hostSecret, false)
+		if hostErr != nil {
+			a.Close()
+		}
+	}()
+	client, clientErr = clientHandshake(b, clientSecret)
+	if clientErr != nil {
+		b.Close()
+	}
+	<-done
+	return
+}
+
+func TestHandshakeRoundTrip(t *testing.T) {
+	secret := newLobbySecret()
+	host, client, hostErr, clientErr := handshake(secret, secret)
+	if hostErr != nil || clientErr != nil {
+		t.Fatalf("handshake: host %v, client %v", hostErr, clientErr)
+	}
+	defer host.Close()
+	defer client.Close()
+
+	for _, dir := range []struct {
+		name     string
+		from, to net.Conn
+		msg      string
+	}{
+		{"client to host", client, host, `{"t":"hello"}`},
+		{"host to client", host, client, `{"t":"welcome"}`},
+		{"client to host again", client, host, `{"t":"ready"}`},
+	} {
+		go dir.from.Write([]byte(dir.msg))
+		buf := make([]byte, len(dir.msg))
+		if _, err := io.ReadFull(dir.to, buf); err != nil || string(buf) != dir.msg {
+			t.Errorf("%s: read %q, %v; want %q", dir.name, buf, err, dir.msg)
+		}
+	}
+}
+
+func TestHandshakeWrongSecret(t *testing.T) {
+	_, _, hostErr, clientErr := handshake(newLobbySecret(), newLobbySecret())
+	if !errors.Is(clientErr, ErrAuth) {
+		t.Errorf("client err = %v, want ErrAuth", clientErr)
+	}
+	if !errors.Is(hostErr, ErrAuth) {
+		t.Errorf("host err = %v, want ErrAuth", hostErr)
+	}
+}
+
+func TestHandshakeNotFarkle(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	go b.Write(append([]byte("GET / HTTP/1.1\r\n"), make([]byte, 32)...))
+	if _, _, err := serverHandshake(a, newLobbySecret(), false); !errors.Is(err, ErrAuth) {
+		t.Errorf("err = %v, want ErrAuth", err)
+	}
+}
+
+func TestHandshakePlainClient(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	go b.Write([]byte(`{"t":"hello"}`))
+	if _, _, err := serverHandshake(a, newLobbySecret(), false); !errors.Is(err, ErrPlaintext) {
+		t.Errorf("err = %v, want ErrPlaintext", err)
+	}
+}
+
+func TestPairing(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	var host net.Conn
+	var hostCode string
+	var hostErr error
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		host, hostCode, hostErr = serverHandshake(a, newLobbySecret(), true)
+	}()
+	client, clientCode, clientErr := pairHandshake(b)
+	<-done
+	if hostErr != nil || clientErr != nil {
+		t.Fatalf("pairing: host %v, client %v", hostErr, clientErr)
+	}
+	if len(hostCode) != pairCodeDigits || hostCode != clientCode {
+		t.Errorf("codes %q and %q; want the same %d digits", hostCode, clientCode, pairCodeDigits)
+	}
+	go client.Write([]byte(`{"t":"hello"}`))
+	buf := make([]byte, 13)
+	if _, err := io.ReadFull(host, buf); err != nil || string(buf) != `{"t":"hello"}` {
+		t.Errorf("read %q, %v", buf, err)
+	}
+}
+
+func TestPairingRefused(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	go pairHandshake(b)
+	if _, _, err := serverHandshake(a, newLobbySecret(), false); !errors.Is(err, ErrAuth) {
+		t.Errorf("pairing with an unlisted lobby: err = %v, want ErrAuth", err)
+	}
+}
+
+func TestPairingCommitment(t *testing.T) {
+	a, b := net.Pipe()
+	defer b.Close()
+	go func() {
+		// Commit to one key, then send another.
+		sum := sha256.Sum256(newPairKey().PublicKey().Bytes())
+		b.Write(append([]byte(pairMagic), sum[:]...))
+		io.ReadFull(b, make([]byte, 32))
+		b.Write(newPairKey().PublicKey().Bytes())
+	}()
+	if _, _, err := serverHandshake(a, newLobbySecret(), true); !errors.Is(err, ErrAuth) {
+		t.Errorf("key that does not match its commitment: err = %v, want ErrAuth", err)
+	}
+}
+
+// frameRecorder is a connection that keeps every frame written to it.
+type frameRecorder struct {
+	net.Conn
+	frames [][]byte
+}
+
+func (r *frameRecorder) Write(p []byte) (int, error) {
+	r.frames = append(r.frames, bytes.Clone(p))
+	return len(p), nil
+}
+
+// sealedFrames returns the client's frames for msgs and a host-side
+// connection whose raw end the test writes frames into.
+func sealedFrames(t *testing.T, msgs ...string) (frames [][]byte, host net.Conn, raw net.Conn) {
+	t.Helper()
+	secret, cn, hn := newLobbySecret(), randomNonce(), randomNonce()
+	rec := &frameRecorder{}
+	client, err := newSecureConn(rec, secret, cn, hn, "client→host", "host→client")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range msgs {
+		client.Write([]byte(m))
+	}
+	a, b := net.Pipe()
+	host, err = newSecureConn(a, secret, cn, hn, "host→client", "client→host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { a.Close(); b.Close() })
+	return rec.frames, host, b
+}
+
+// deliver writes frames to raw and reads one message per frame from host,
+// returning the first error.
+func deliver(host, raw net.Conn, frames ...[]byte) ([]string, error) {
+	go func() {
+		for _, f := range frames {
+			if _, err := raw.Write(f); err != nil {
+				return
+			}
+		}
+	}()
+	var got []string
+	for range frames {
+		buf := make([]byte, 64)
+		n, err := host.Read(buf)
+		if err != nil {
+			return got, err
+		}
+		got = append(got, string(buf[:n]))
+	}
+	return got, nil
+}
+
+func TestSecureConnRejects(t *testing.T) {
+	t.Run("clean", func(t *testing.T) {
+		frames, host, raw := sealedFrames(t, "one", "two")
+		got, err := deliver(host, raw, frames...)
+		if err != nil || len(got) != 2 || got[0] != "one" || got[1] != "two" {
+			t.Errorf("got %q, %v", got, err)
+		}
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		frames, host, raw := sealedFrames(t, "one")
+		frames[0][6] ^= 1
+		if _, err := deliver(host, raw, frames...); !errors.Is(err, ErrAuth) {
+			t.Errorf("err = %v, want ErrAuth", err)
+		}
+	})
+
+	t.Run("replayed", func(t *testing.T) {
+		frames, host, raw := sealedFrames(t, "one")
+		got, err := deliver(host, raw, frames[0], frames[0])
+		if len(got) != 1 || !errors.Is(err, ErrAuth) {
+			t.Errorf("got %q, %v; want the first copy then ErrAuth", got, err)
+		}
+	})
+
+	t.Run("reordered", func(t *testing.T) {
+		frames, host, raw := sealedFrames(t, "one", "two")
+		if got, err := deliver(host, raw, frames[1], frames[0]); len(got) != 0 || !errors.Is(err, ErrAuth) {
+			t.Errorf("got %q, %v; want ErrAuth", got, err)
+		}
+	})
+
+	t.Run("oversized", func(t *testing.T) {
+		_, host, raw := sealedFrames(t)
+		var hdr [4]byte
+		binary.BigEndian.PutUint32(hdr[:], maxFrame+1024)
+		if _, err := deliver(host, raw, hdr[:]); !errors.Is(err, ErrAuth) {
+			t.Errorf("err = %v, want ErrAuth", err)
+		}
+	})
+}
@@ -0,0 +1,74 @@
+package solver
+
+// MARK: Expected-value policy
+
+// EVTable maximises the expected points banked this turn.
+type EVTable struct {
+	Rules string // rule set the table was solved for
+	Step  int    // turn-score granularity in points
+	Cap   int    // turn scores at or above Cap always bank
+	Roll  []float32
+}
+
+// SolveEV builds the expected-value policy for turn scores below cap.
+func SolveEV(score Scorer, step, cap int) *EVTable {
+	if step <= 0 {
+		step = 50
+	}
+	capU := (cap + step - 1) / step
+	t := &EVTable{Step: step, Cap: capU * step, Roll: make([]float32, capU*6)}
+
+	outs := make([][]Outcome, 7)
+	for n := 1; n <= 6; n++ {
+		outs[n] = mergeOutcomes(Outcomes(n, score), step)
+	}
+	// Every keep adds at least one step, so turn scores can be solved from
+	// the cap downwards in a single pass.
+	for u := capU - 1; u >= 0; u-- {
+		for n := 1; n <= 6; n++ {
+			ev := 0.0
+			for _, o := range outs[n] {
+				best := 0.0
+				for _, m := range o.Moves {
+					next := n - m.Kept
+					if next == 0 {
+						next = 6
+					}
+					if v := t.value(u+m.Points, next); v > best {
+						best = v
+					}
+				}
+				ev += o.Prob * best
+			}
+			t.Roll[u*6+n-1] = float32(ev)
+		}
+	}
+	return t
+}
+
+func (t *EVTable) value(u, n int) float64 {
+	bank := float64(u * t.Step)
+	if u*t.Step >= t.Cap {
+		return bank
+	}
+	return max(bank, float64(t.Roll[u*6+n-1]))
+}
+
+// Value is the expected banked turn score from s.
+func (t *EVTable) Value(s State) float64 {
+	return t.value(s.Turn/t.Step, s.Dice)
+}
+
+// ShouldRoll reports whether rolling beats banking s.Turn.
+func (t *EVTable) ShouldRoll(s State) bool {
+	u := s.Turn / t.Step
+	if s.Turn >= t.Cap {
+		return false
+	}
+	return float64(t.Roll[u*6+s.Dice-1]) > float64(s.Turn)
+}
+
+// TurnValue is the expected score of a whole turn started with six dice.
+func (t *EVTable) TurnValue() float64 {
+	return float64(t.Roll[5])
+}
@@ -0,0 +1,267 @@
+// Package solver computes optimal bank-or-roll policies for Farkle.
+//
+// Two tables are provided: EVTable maximises the expected score of a single
+// turn, WinTable maximises the probability of winning a two-player race to
+// a target. Both are built once from a rule set's Scorer, can be saved to
+// disk, and answer every query with a constant-time lookup.
+package solver
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Scorer returns the points for keeping dice, or 0 when the selection is not
+// a legal keep (every die must score).
+type Scorer func(dice []int) int
+
+// State is a decision point after a keep: Turn unbanked points with Dice dice
+// left to roll. Score and Opp are the banked totals; EVTable ignores them.
+type State struct {
+	Score, Opp int
+	Turn       int
+	Dice       int
+}
+
+// Table is a solved policy.
+type Table interface {
+	// Value is the worth of s when playing on optimally, in the table's unit.
+	Value(s State) float64
+	// ShouldRoll reports whether rolling again beats banking at s.
+	ShouldRoll(s State) bool
+}
+
+// MARK: Roll outcomes
+
+// Move is the best keep from a roll that sets aside Kept dice.
+type Move struct {
+	Points int
+	Kept   int
+}
+
+// Outcome is one distinct roll (as a multiset) and its probability.
+type Outcome struct {
+	Dice  []int
+	Prob  float64
+	Moves []Move // best keep per number of dice kept; empty on a farkle
+}
+
+// Outcomes enumerates every distinct roll of n dice with its legal moves.
+func Outcomes(n int, score Scorer) []Outcome {
+	var out []Outcome
+	total := 1.0
+	for i := 0; i < n; i++ {
+		total *= 6
+	}
+	var walk func(face int, left int, dice []int)
+	walk = func(face int, left int, dice []int) {
+		if left == 0 {
+			roll := append([]int(nil), dice...)
+			out = append(out, Outcome{
+				Dice:  roll,
+				Prob:  float64(arrangements(roll)) / total,
+				Moves: moves(roll, score),
+			})
+			return
+		}
+		for f := face; f <= 6; f++ {
+			walk(f, left-1, append(dice, f))
+		}
+	}
+	walk(1, n, nil)
+	return out
+}
+
+// FarkleChance is the probability that n dice roll no legal keep at all.
+func FarkleChance(n int, score Scorer) float64 {
+	p := 0.0
+	for _, o := range Outcomes(n, score) {
+		if len(o.Moves) == 0 {
+			p += o.Prob
+		}
+	}
+	return p
+}
+
+// Keeps lists every legal keep of roll (as sorted sub-multisets).
+func Keeps(roll []int, score Scorer) [][]int {
+	var counts [7]int
+	for _, d := range roll {
+		counts[d]++
+	}
+	var out [][]int
+	var walk func(face int, kept []int)
+	walk = func(face int, kept []int) {
+		if face > 6 {
+			if len(kept) > 0 && score(kept) > 0 {
+				out = append(out, append([]int(nil), kept...))
+			}
+			return
+		}
+		for c := 0; c <= counts[face]; c++ {
+			next := kept
+			for i := 0; i < c; i++ {
+				next = append(next, face)
+			}
+			walk(face+1, next)
+		}
+	}
+	walk(1, nil)
+	return out
+}
+
+func moves(roll []int, score Scorer) []Move {
+	best := make(map[int]int)
+	for _, k := range Keeps(roll, score) {
+		if p := score(k); p > best[len(k)] {
+			best[len(k)] = p
+		}
+	}
+	var out []Move
+	for kept := 1; kept <= len(roll); kept++ {
+		if p, ok := best[kept]; ok {
+			out = append(out, Move{Points: p, Kept: kept})
+		}
+	}
+	return out
+}
+
+func arrangements(roll []int) int {
+	var counts [7]int
+	n := 1
+	for i, d := range roll {
+		counts[d]++
+		n = n * (i + 1) / counts[d]
+	}
+	return n
+}
+
+// BestKeep picks the keep from roll that leads to the most valuable state and
+// reports whether to roll on afterwards.
+func BestKeep(t Table, s State, roll []int, score Scorer) (keep []int, rollOn bool) {
+	bestVal := -1.0
+	for _, k := range Keeps(roll, score) {
+		next := After(s, len(roll), k, score)
+		v := t.Value(next)
+		if v > bestVal || (v == bestVal && len(k) < len(keep)) {
+			bestVal, keep = v, k
+		}
+	}
+	if keep == nil {
+		return nil, false
+	}
+	return keep, t.ShouldRoll(After(s, len(roll), keep, score))
+}
+
+// After is the state reached by keeping k from a roll of n dice at s.
+func After(s State, n int, k []int, score Scorer) State {
+	s.Turn += score(k)
+	s.Dice = n - len(k)
+	if s.Dice == 0 {
+		s.Dice = 6
+	}
+	return s
+}
+
+// mergeOutcomes converts move points to steps and folds together rolls that
+// offer the same moves, which is all the solvers need to know about them.
+func mergeOutcomes(outs []Outcome, step int) []Outcome {
+	var merged []Outcome
+	seen := make(map[string]int)
+	for _, o := range outs {
+		moves := make([]Move, len(o.Moves))
+		for i, m := range o.Moves {
+			moves[i] = Move{Points: units(m.Points, step), Kept: m.Kept}
+		}
+		key := fmt.Sprint(moves)
+		if i, ok := seen[key]; ok {
+			merged[i].Prob += o.Prob
+			continue
+		}
+		seen[key] = len(merged)
+		merged = append(merged, Outcome{Prob: o.Prob, Moves: moves})
+	}
+	return merged
+}
+
+// units converts points to table steps, to the nearest step. Every scoring
+// keep moves at least one step so that turns always progress; on a 50-point
+// grid every preset's points are exact.
+func units(points, step int) int {
+	u := (points + step/2) / step
+	if u < 1 {
+		u = 1
+	}
+	return u
+}
+
+// MARK: Persistence
+
+const fileVersion = 2
+
+type tableFile struct {
+	Version int
+	EV      *EVTable
+	Win     *WinTable
+}
+
+// ErrVersion is returned when a saved table was written by another version.
+var ErrVersion = errors.New("solver: unsupported table version")
+
+// Save writes a table produced by SolveEV or SolveWin.
+func Save(w io.Writer, t Table) error {
+	f := tableFile{Version: fileVersion}
+	switch t := t.(type) {
+	case *EVTable:
+		f.EV = t
+	case *WinTable:
+		f.Win = t
+	default:
+		return errors.New("solver: unknown table type")
+	}
+	return gob.NewEncoder(w).Encode(f)
+}
+
+// Load reads a table written by Save.
+func Load(r io.Reader) (Table, error) {
+	var f tableFile
+	if err := gob.NewDecoder(r).Decode(&f); err != nil {
+		return nil, err
+	}
+	if f.Version != fileVersion {
+		return nil, ErrVersion
+	}
+	if f.EV != nil {
+		return f.EV, nil
+	}
+	if f.Win != nil {
+		return f.Win, nil
+	}
+	return nil, errors.New("solver: empty table file")
+}
+
+// SaveFile writes t to path.
+func SaveFile(path string, t Table) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := Save(f, t); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadFile reads a table from path.
+func LoadFile(path string) (Table, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return Load(f)
+}
@@ -0,0 +1,149 @@
+package solver_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"errors"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"farkle/farkle"
+	"farkle/farkle/solver"
+)
+
+var classic = farkle.ClassicRules.KeepScore
+
+func TestFarkleChance(t *testing.T) {
+	// Farkling rolls out of 6^n: no 1s or 5s and no three of a kind. Classic
+	// has no three-pairs combination, so 2-2-3-3-4-4 farkles.
+	for n, want := range map[int]float64{
+		1: 4.0 / 6,
+		2: 16.0 / 36,
+		3: 60.0 / 216,
+		4: 204.0 / 1296,
+		5: 600.0 / 7776,
+		6: 1440.0 / 46656,
+	} {
+		if got := solver.FarkleChance(n, classic); math.Abs(got-want) > 1e-9 {
+			t.Errorf("FarkleChance(%d) = %.6f, want %.6f", n, got, want)
+		}
+	}
+}
+
+func TestOutcomes(t *testing.T) {
+	for n := 1; n <= 6; n++ {
+		outs := solver.Outcomes(n, classic)
+		sum := 0.0
+		for _, o := range outs {
+			sum += o.Prob
+			for _, m := range o.Moves {
+				if m.Kept < 1 || m.Kept > n || m.Points <= 0 {
+					t.Errorf("roll %v: move %+v", o.Dice, m)
+				}
+			}
+		}
+		if math.Abs(sum-1) > 1e-9 {
+			t.Errorf("%d dice: probabilities sum to %f", n, sum)
+		}
+	}
+}
+
+func TestTurnValue(t *testing.T) {
+	ev := solver.SolveEV(classic, 50, 10000)
+	if got := ev.TurnValue(); math.Abs(got-550.6) > 0.1 {
+		t.Errorf("TurnValue = %.2f, want 550.6", got)
+	}
+	for _, tt := range []struct {
+		s    solver.State
+		roll bool
+	}{
+		{solver.State{Turn: 300, Dice: 6}, true},
+		{solver.State{Turn: 300, Dice: 1}, false},
+		{solver.State{Turn: 250, Dice: 2}, false},
+		{solver.State{Turn: 10000, Dice: 6}, false},
+	} {
+		if got := ev.ShouldRoll(tt.s); got != tt.roll {
+			t.Errorf("ShouldRoll(%+v) = %v, want %v", tt.s, got, tt.roll)
+		}
+	}
+}
+
+func TestWinTable(t *testing.T) {
+	const target, tol = 1000, 1e-4
+	w := solver.SolveWin(classic, target, 0)
+
+	for i, p := range w.Roll {
+		if p < 0 || p > 1 || math.IsNaN(float64(p)) {
+			t.Fatalf("Roll[%d] = %f, not a probability", i, p)
+		}
+	}
+	if p := w.StartChance(0, 0); p <= 0.5 || p >= 0.7 {
+		t.Errorf("StartChance(0, 0) = %.3f; the first player should be ahead, but not by that much", p)
+	}
+
+	// Totals off the sample grid exercise the interpolation too.
+	for score := 0; score < target; score += 35 {
+		for opp := 0; opp < target; opp += 35 {
+			p := w.StartChance(score, opp)
+			if p < 0 || p > 1 {
+				t.Fatalf("StartChance(%d, %d) = %f", score, opp, p)
+			}
+			if up := w.StartChance(score+35, opp); up < p-tol {
+				t.Errorf("StartChance falls from %.4f to %.4f as score rises past %d (opp %d)", p, up, score, opp)
+			}
+			if down := w.StartChance(score, opp+35); down > p+tol {
+				t.Errorf("StartChance rises from %.4f to %.4f as opp rises past %d (score %d)", p, down, opp, score)
+			}
+			for d := 1; d <= 6; d++ {
+				s := solver.State{Score: score, Opp: opp, Turn: 100, Dice: d}
+				v := w.Value(s)
+				s.Turn += 50
+				if more := w.Value(s); more < v-tol {
+					t.Errorf("Value falls from %.4f to %.4f with 50 more turn points at %+v", v, more, s)
+				}
+			}
+		}
+	}
+
+	done := solver.State{Score: 900, Opp: 950, Turn: 100, Dice: 3}
+	if w.Value(done) != 1 || w.ShouldRoll(done) {
+		t.Errorf("at the target: Value %f, ShouldRoll %v; want 1 and a bank", w.Value(done), w.ShouldRoll(done))
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	for _, table := range []solver.Table{
+		solver.SolveEV(classic, 50, 3000),
+		solver.SolveWin(classic, 500, 0),
+	} {
+		var buf bytes.Buffer
+		if err := solver.Save(&buf, table); err != nil {
+			t.Fatal(err)
+		}
+		got, err := solver.Load(&buf)
+		if err != nil || !reflect.DeepEqual(got, table) {
+			t.Errorf("%T did not survive Save and Load: %v", table, err)
+		}
+
+		path := filepath.Join(t.TempDir(), "policy.gob")
+		if err := solver.SaveFile(path, table); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := solver.LoadFile(path); err != nil || !reflect.DeepEqual(got, table) {
+			t.Errorf("%T did not survive SaveFile and LoadFile: %v", table, err)
+		}
+	}
+
+	// A file from an older release: same layout, earlier version.
+	type tableFile struct {
+		Version int
+		EV      *solver.EVTable
+	}
+	var old bytes.Buffer
+	gob.NewEncoder(&old).Encode(tableFile{Version: 1, EV: solver.SolveEV(classic, 50, 1000)})
+	if _, err := solver.Load(&old); !errors.Is(err, solver.ErrVersion) {
+		t.Errorf("Load of a version 1 file: err = %v, want ErrVersion", err)
+	}
+}
@@ -0,0 +1,188 @@
+package solver
+
+import "math"
+
+// MARK: Win-probability policy
+
+// WinTable maximises the chance of winning a two-player race to Target.
+// The turn score is tracked exactly on a Grain-point grid. Banked scores are
+// sampled every Step points and interpolated in between, so large targets
+// trade precision on the totals only.
+type WinTable struct {
+	Rules  string // rule set the table was solved for
+	Target int
+	Step   int       // spacing of the banked-score samples
+	Grain  int       // turn-score resolution
+	N      int       // banked samples a side: 0, Step, …, (N-1)·Step
+	U      int       // turn scores tracked: 0, Grain, …, (U-1)·Grain
+	Roll   []float32 // win chance when rolling, indexed by idx
+}
+
+// TurnGrain is the turn-score resolution of a WinTable. Every preset scores
+// in multiples of it, so turn points are never rounded.
+const TurnGrain = 50
+
+// WinStep picks a banked-score spacing that keeps a table for target to
+// roughly 40 samples a side.
+func WinStep(target int) int {
+	step := (target/40 + 49) / 50 * 50
+	return max(step, 50)
+}
+
+// SolveWin builds the win-probability policy by value iteration over the
+// players' turn-start chances.
+func SolveWin(score Scorer, target, step int) *WinTable {
+	if step <= 0 {
+		step = WinStep(target)
+	}
+	n := (target + step - 1) / step
+	un := (target + TurnGrain - 1) / TurnGrain
+	t := &WinTable{Target: target, Step: step, Grain: TurnGrain, N: n, U: un, Roll: make([]float32, n*n*un*6)}
+
+	outs := make([][]Outcome, 7)
+	for d := 1; d <= 6; d++ {
+		outs[d] = mergeOutcomes(Outcomes(d, score), TurnGrain)
+	}
+
+	// start[i*n+j]: chance that the player to move at sample i wins from a
+	// fresh turn against sample j.
+	start := make([]float64, n*n)
+	for i := range start {
+		start[i] = 0.5
+	}
+	startAt := func(mover, other int) float64 { return start[mover*n+other] }
+	w := make([]float64, (un+1)*7) // W(turn, dice) for the current (i, j)
+	for iter := 0; iter < 500; iter++ {
+		delta := 0.0
+		for i := n - 1; i >= 0; i-- {
+			base := i * step
+			for j := n - 1; j >= 0; j-- {
+				farkle := 1 - start[j*n+i]
+				for u := (target - base - 1) / TurnGrain; u >= 0; u-- {
+					for d := 1; d <= 6; d++ {
+						p := 0.0
+						for _, o := range outs[d] {
+							if len(o.Moves) == 0 {
+								p += o.Prob * farkle
+								continue
+							}
+							best := 0.0
+							for _, m := range o.Moves {
+								next := d - m.Kept
+								if next == 0 {
+									next = 6
+								}
+								v := 1.0
+								if nu := u + m.Points; base+nu*TurnGrain < target {
+									v = w[nu*7+next]
+								}
+								best = max(best, v)
+							}
+							p += o.Prob * best
+						}
+						t.Roll[t.idx(i, j, u, d)] = float32(p)
+						w[u*7+d] = max(p, t.banked(i, j, u, startAt))
+					}
+				}
+				v := w[6]
+				delta = max(delta, math.Abs(v-start[i*n+j]))
+				start[i*n+j] = v
+			}
+		}
+		if delta < 1e-6 {
+			break
+		}
+	}
+	return t
+}
+
+func (t *WinTable) idx(i, j, u, d int) int {
+	return ((i*t.N+j)*t.U+u)*6 + d - 1
+}
+
+// banked is the chance of winning by banking u grains at sample i against
+// sample j, after which the opponent moves from a fresh turn. A total that
+// falls between two samples interpolates between them.
+func (t *WinTable) banked(i, j, u int, start func(mover, other int) float64) float64 {
+	if u == 0 {
+		return 0
+	}
+	total := i*t.Step + u*t.Grain
+	if total >= t.Target {
+		return 1
+	}
+	k := total / t.Step
+	f := float64(total%t.Step) / float64(t.Step)
+	opp := (1 - f) * start(j, k)
+	if k+1 < t.N { // past the last sample the total has reached the target
+		opp += f * start(j, k+1)
+	}
+	return 1 - opp
+}
+
+func (t *WinTable) start(mover, other int) float64 {
+	return float64(t.Roll[t.idx(mover, other, 0, 6)])
+}
+
+// at is the chance of winning when rolling on and when banking at samples
+// (i, j) with u turn grains and d dice to roll.
+func (t *WinTable) at(i, j, u, d int) (roll, bank float64) {
+	switch {
+	case j >= t.N:
+		return 0, 0
+	case i >= t.N || i*t.Step+u*t.Grain >= t.Target:
+		return 1, 1
+	}
+	return float64(t.Roll[t.idx(i, j, u, d)]), t.banked(i, j, u, t.start)
+}
+
+// lookup interpolates the rolling and banking chances at s between the four
+// nearest banked-score samples.
+func (t *WinTable) lookup(s State) (roll, bank float64) {
+	if s.Score+s.Turn >= t.Target {
+		return 1, 1
+	}
+	u := max(s.Turn+t.Grain/2, 0) / t.Grain
+	xi := float64(max(s.Score, 0)) / float64(t.Step)
+	xj := float64(max(s.Opp, 0)) / float64(t.Step)
+	i, j := int(xi), int(xj)
+	fi, fj := xi-float64(i), xj-float64(j)
+	for _, c := range [4]struct {
+		di, dj int
+		w      float64
+	}{
+		{0, 0, (1 - fi) * (1 - fj)},
+		{1, 0, fi * (1 - fj)},
+		{0, 1, (1 - fi) * fj},
+		{1, 1, fi * fj},
+	} {
+		if c.w == 0 {
+			continue
+		}
+		r, b := t.at(i+c.di, j+c.dj, u, s.Dice)
+		roll += c.w * r
+		bank += c.w * b
+	}
+	return roll, bank
+}
+
+// Value is the chance of winning from s.
+func (t *WinTable) Value(s State) float64 {
+	roll, bank := t.lookup(s)
+	return max(roll, bank)
+}
+
+// ShouldRoll reports whether rolling gives a better chance than banking.
+func (t *WinTable) ShouldRoll(s State) bool {
+	if s.Score+s.Turn >= t.Target {
+		return false
+	}
+	roll, bank := t.lookup(s)
+	return roll > bank
+}
+
+// StartChance is the chance that the player about to start a turn wins.
+func (t *WinTable) StartChance(score, opp int) float64 {
+	roll, _ := t.lookup(State{Score: score, Opp: opp, Dice: 6})
+	return roll
+}
@@ -0,0 +1,211 @@
+package farkle
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"farkle/farkle/solver"
+)
+
+// MARK: Strategy
+
+// Strategy plays for a computer seat. Keep picks dice from g.Turn.Roll; Bank
+// is asked after each keep whether to stop. The driver still enforces the
+// opening score and final-round rules on top of the answer.
+type Strategy interface {
+	Name() string
+	Keep(g *Game) []int
+	Bank(g *Game, kept []int) bool
+}
+
+var strategies = map[string]func() Strategy{
+	"easy":     func() Strategy { return easyStrategy{} },
+	"cautious": func() Strategy { return cautiousStrategy{} },
+	"reckless": func() Strategy { return recklessStrategy{} },
+	"gap":      func() Strategy { return gapStrategy{} },
+	"hard":     func() Strategy { return &HardStrategy{} },
+}
+
+// DefaultStrategy is the computer opponent used when none is chosen.
+const DefaultStrategy = "easy"
+
+// NewStrategy returns a fresh built-in strategy by name.
+func NewStrategy(name string) (Strategy, error) {
+	mk, ok := strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown AI %q (choose from %v)", name, StrategyNames())
+	}
+	return mk(), nil
+}
+
+// StrategyNames lists the built-in strategies.
+func StrategyNames() []string {
+	names := make([]string, 0, len(strategies))
+	for n := range strategies {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// MARK: Built-ins
+
+// easyStrategy keeps every scoring die and banks on a fixed heuristic.
+type easyStrategy struct{}
+
+func (easyStrategy) Name() string { return "easy" }
+
+func (easyStrategy) Keep(g *Game) []int {
+	kept, _ := g.Rules.Best(g.Turn.Roll)
+	return kept
+}
+
+func (easyStrategy) Bank(g *Game, kept []int) bool {
+	return g.Turn.Score >= 1000 || g.Turn.DiceLeft <= 2 || len(kept) >= 5
+}
+
+// cautiousStrategy takes small, safe turns.
+type cautiousStrategy struct{}
+
+func (cautiousStrategy) Name() string { return "cautious" }
+
+func (cautiousStrategy) Keep(g *Game) []int {
+	kept, _ := g.Rules.Best(g.Turn.Roll)
+	return kept
+}
+
+func (cautiousStrategy) Bank(g *Game, kept []int) bool {
+	return g.Turn.Score >= 300 || g.Turn.DiceLeft <= 3
+}
+
+// recklessStrategy sets aside as few dice as possible and chases big turns.
+type recklessStrategy struct{}
+
+func (recklessStrategy) Name() string { return "reckless" }
+
+func (recklessStrategy) Keep(g *Game) []int {
+	var best []int
+	bestPts := 0
+	for _, k := range solver.Keeps(g.Turn.Roll, g.Rules.KeepScore) {
+		pts := g.Rules.Score(k)
+		if best == nil || len(k) < len(best) || (len(k) == len(best) && pts > bestPts) {
+			best, bestPts = k, pts
+		}
+	}
+	// Hot dice, or a keep worth far more than the cheapest one, is still taken.
+	all, pts := g.Rules.Best(g.Turn.Roll)
+	if len(all) == len(g.Turn.Roll) || pts >= 2*bestPts+500 {
+		return all
+	}
+	return best
+}
+
+func (recklessStrategy) Bank(g *Game, kept []int) bool {
+	return g.Turn.Score >= 2000 || (g.Turn.DiceLeft == 1 && g.Turn.Score >= 600)
+}
+
+// gapStrategy pushes harder the further it trails the leader and plays safe
+// when ahead.
+type gapStrategy struct{}
+
+func (gapStrategy) Name() string { return "gap" }
+
+func (gapStrategy) Keep(g *Game) []int {
+	kept, _ := g.Rules.Best(g.Turn.Roll)
+	return kept
+}
+
+func (gapStrategy) Bank(g *Game, kept []int) bool {
+	me := g.Current().Total
+	if me+g.Turn.Score >= g.Target {
+		return true
+	}
+	gap := g.leaderTotal(g.Turn.Idx) - me
+	threshold := 300
+	if gap > 0 {
+		threshold = min(350+gap/3, 2500)
+	}
+	if g.Turn.DiceLeft <= 2 {
+		threshold /= 2
+	}
+	return g.Turn.Score >= threshold
+}
+
+// MARK: Hard (solver-backed)
+
+// HardStrategy plays the solver's win-probability policy against the best
+// opponent score. Tables are cached under the user cache directory.
+type HardStrategy struct {
+	table solver.Table
+}
+
+func (*HardStrategy) Name() string { return "hard" }
+
+// Prepare loads or solves the policy for g's rules and target ahead of the
+// first turn. It reports whether the table had to be solved.
+func (h *HardStrategy) Prepare(g *Game) (solved bool) {
+	if h.table != nil {
+		return false
+	}
+	h.table, solved = loadPolicy(g.Rules, g.Target)
+	return solved
+}
+
+func (h *HardStrategy) state(g *Game) solver.State {
+	return solver.State{
+		Score: g.Current().Total,
+		Opp:   g.leaderTotal(g.Turn.Idx),
+		Turn:  g.Turn.Score,
+		Dice:  g.Turn.DiceLeft,
+	}
+}
+
+func (h *HardStrategy) Keep(g *Game) []int {
+	h.Prepare(g)
+	kept, _ := solver.BestKeep(h.table, h.state(g), g.Turn.Roll, g.Rules.KeepScore)
+	return kept
+}
+
+func (h *HardStrategy) Bank(g *Game, kept []int) bool {
+	h.Prepare(g)
+	return !h.table.ShouldRoll(h.state(g))
+}
+
+// loadPolicy returns the cached win table for rules and target, solving and
+// caching it when missing.
+func loadPolicy(rules *ScoringRules, target int) (solver.Table, bool) {
+	data, _ := json.Marshal(rules)
+	sum := sha256.Sum256(data)
+	name := fmt.Sprintf("policy-%s-%x-%d.gob", rules.Name, sum[:6], target)
+	var path string
+	if dir, err := os.UserCacheDir(); err == nil {
+		path = filepath.Join(dir, "farkle", name)
+		if t, err := solver.LoadFile(path); err == nil {
+			if w, ok := t.(*solver.WinTable); ok && w.Target == target {
+				return w, false
+			}
+		}
+	}
+	w := solver.SolveWin(rules.KeepScore, target, 0)
+	w.Rules = rules.Name
+	if path != "" && os.MkdirAll(filepath.Dir(path), 0o755) == nil {
+		solver.SaveFile(path, w)
+	}
+	return w, true
+}
+
+// leaderTotal is the highest total among the players other than i.
+func (g *Game) leaderTotal(i int) int {
+	best := 0
+	first := true
+	for j, p := range g.Players {
+		if j != i && (first || p.Total > best) {
+			best, first = p.Total, false
+		}
+	}
+	return best
+}
@@ -0,0 +1,73 @@
+package farkle
+
+import (
+	"testing"
+
+	"farkle/farkle/solver"
+)
+
+// botMatch plays seeded two-player games between a and b, alternating who
+// opens, and returns the share of games a wins.
+func botMatch(t *testing.T, a, b Strategy, target, games int) float64 {
+	t.Helper()
+	wins := 0
+	for n := 0; n < games; n++ {
+		seats := []Player{{Name: "a", Bot: a}, {Name: "b", Bot: b}}
+		if n%2 == 1 {
+			seats[0], seats[1] = seats[1], seats[0]
+		}
+		g := NewGame(Options{Target: target, Dice: NewSeededDice(uint64(n + 1))}, seats...)
+		for !g.Over {
+			playBotTurn(t, g)
+		}
+		if g.Players[g.Winner].Name == "a" {
+			wins++
+		}
+	}
+	return float64(wins) / float64(games)
+}
+
+// playBotTurn plays one turn for the current player's strategy.
+func playBotTurn(t *testing.T, g *Game) {
+	t.Helper()
+	bot := g.Current().Bot
+	for {
+		if g.Turn.Roll == nil {
+			events, err := g.Roll()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if hasEvent(events, EvFarkle) {
+				return
+			}
+		}
+		kept := bot.Keep(g)
+		if _, err := g.Keep(kept); err != nil {
+			t.Fatalf("%s kept %v from %v: %v", bot.Name(), kept, g.Turn.Roll, err)
+		}
+		if aiWantsBank(g, bot, kept) {
+			if _, err := g.Bank(nil); err != nil {
+				t.Fatal(err)
+			}
+			return
+		}
+	}
+}
+
+func TestHardBeatsHeuristics(t *testing.T) {
+	if testing.Short() {
+		t.Skip("solves full policy tables")
+	}
+	const games = 2000
+	for _, target := range []int{1000, 10000} {
+		hard := &HardStrategy{table: solver.SolveWin(ClassicRules.KeepScore, target, 0)}
+		for _, name := range []string{"easy", "gap"} {
+			opp, _ := NewStrategy(name)
+			share := botMatch(t, hard, opp, target, games)
+			t.Logf("target %d: hard wins %.1f%% against %s", target, 100*share, name)
+			if share <= 0.5 {
+				t.Errorf("target %d: hard won only %.1f%% of %d games against %s", target, 100*share, games, name)
+			}
+		}
+	}
+}
@@ -4,12 +4,12 @@ go 1.24.2
 
 require (
 	fyne.io/fyne/v2 v2.6.1
+	github.com/BurntSushi/toml v1.4.0
 	github.com/huin/goupnp v1.3.0
 )
 
 require (
 	fyne.io/systray v1.11.0 // indirect
-	github.com/BurntSushi/toml v1.4.0 // indirect
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/fredbi/uri v1.1.0 // indirect
 	github.com/fsnotify/fsnotify v1.7.0 // indirect
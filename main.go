@@ -1,13 +1,14 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
-	"os"
+	"net"
 	"strconv"
 	"strings"
+	"time"
 
 	"farkle/farkle"
+	"farkle/farkle/solver"
 )
 
 const (
@@ -23,22 +24,55 @@ const (
 const banner = ColorCyan + `=== Welcome to Farkle ===` + ColorReset + `
 ` + ColorGreen + `Single‑player:` + ColorReset + `
   ` + ColorYellow + `play [score]` + ColorReset + `                       → solo vs CPU
-` + ColorGreen + `Multiplayer (2 players):` + ColorReset + `
-  ` + ColorYellow + `play [score] --mp --create` + ColorReset + `         → host a lobby
-  ` + ColorYellow + `play --mp --join=<ID>` + ColorReset + `→ join a lobby
+  ` + ColorYellow + `play [score] --seed=<n>` + ColorReset + `            → reproducible game
+  ` + ColorYellow + `play [score] --ai=<level>` + ColorReset + `          → easy, cautious, reckless, gap or hard
+  ` + ColorYellow + `play --players=Ann,Bob[,…]` + ColorReset + `          → hot-seat for 2–8 players on one terminal
+  ` + ColorYellow + `play ... --ai=<n|level,…>` + ColorReset + `          → add AI seats, e.g. --ai=2 or --ai=hard,easy
+  ` + ColorYellow + `play [score] --rules=<preset|file>` + ColorReset + ` → classic, zilch, farkle-10000 or .toml/.json
+  ` + ColorYellow + `play [score] --opening[=500]` + ColorReset + `       → minimum first bank to get on the board
+  ` + ColorYellow + `play [score] --penalty[=1000]` + ColorReset + `      → three farkles in a row lose points
+  ` + ColorYellow + `play [score] --final` + ColorReset + `               → last-chance round after the target is hit
+  ` + ColorYellow + `play --resume=<file>` + ColorReset + `               → continue a game stored with 'save <file>'
+  ` + ColorYellow + `play ... --log=<file>` + ColorReset + `              → record every event as JSONL (any mode)
+` + ColorGreen + `Tools:` + ColorReset + `
+  ` + ColorYellow + `rules [preset|file]` + ColorReset + `                → show scoring tables
+  ` + ColorYellow + `solve [score] [--rules=x] [--out=f]` + ColorReset + ` → optimal policy table
+  ` + ColorYellow + `replay <file>` + ColorReset + `                      → step through a game log turn by turn
+  ` + ColorYellow + `verify <file>` + ColorReset + `                      → check the dice of a --fair game log offline
+` + ColorGreen + `Profiles:` + ColorReset + `
+  ` + ColorYellow + `profile [name]` + ColorReset + `                     → show, create or switch the active profile
+  ` + ColorYellow + `stats [name]` + ColorReset + `                       → lifetime statistics per mode & opponent
+` + ColorGreen + `Multiplayer (up to 7 players):` + ColorReset + `
+  ` + ColorYellow + `play [score] --mp --create` + ColorReset + `         → host a lobby ('start' once everyone is ready)
+  ` + ColorYellow + `play ... --on-drop=<ai|forfeit>` + ColorReset + `    → what happens to a player who drops out (default ai)
+  ` + ColorYellow + `play ... --create --fair` + ColorReset + `           → hash-chain dice every player can check
+  ` + ColorYellow + `play ... --create --host=<addr>` + ColorReset + `    → put this IP (v4 or v6) or hostname in the lobby ID
+  ` + ColorYellow + `play ... --create --lan` + ColorReset + `            → list the lobby on the local network; admit nearby players by code
+  ` + ColorYellow + `play --mp --join=<ID>` + ColorReset + `              → join a lobby ('ready' when you are)
+  ` + ColorYellow + `play --mp --watch=<ID>` + ColorReset + `             → spectate a lobby or a game in progress
+  ` + ColorYellow + `lobbies [flags]` + ColorReset + `                    → find lobbies on the local network and join one by number
 ` + ColorBlue + `Score range 1000‑20000 (default 1000).` + ColorReset + `
 ` + ColorRed + `Type 'exit/quit' to quit.` + ColorReset
 
+// profile is the active player profile; nil plays anonymously.
+var profile *farkle.Profile
+
 func main() {
-	scanner := bufio.NewScanner(os.Stdin)
 	fmt.Println(banner)
+	if name := farkle.CurrentProfile(); name != "" {
+		if p, err := farkle.LoadProfile(name); err == nil {
+			profile = p
+			fmt.Println(ColorGreen + "Playing as " + p.Name + "." + ColorReset)
+		}
+	}
 
 	for {
 		fmt.Print("> ")
-		if !scanner.Scan() {
+		line, ok := farkle.ReadLine()
+		if !ok {
 			break
 		}
-		input := strings.TrimSpace(scanner.Text())
+		input := strings.TrimSpace(line)
 		if input == "" {
 			continue
 		}
@@ -52,8 +86,40 @@ func main() {
 		case "play":
 			handlePlay(tokens[1:])
 
+		case "rules":
+			handleRules(tokens[1:])
+
+		case "solve":
+			handleSolve(tokens[1:])
+
+		case "profile":
+			handleProfile(tokens[1:])
+
+		case "stats":
+			handleStats(tokens[1:])
+
+		case "lobbies":
+			handleLobbies(tokens[1:])
+
+		case "replay":
+			if len(tokens) != 2 {
+				fmt.Println("Usage: replay <file>")
+				continue
+			}
+			if err := farkle.Replay(tokens[1]); err != nil {
+				fmt.Println("Cannot replay:", err)
+			}
+		case "verify":
+			if len(tokens) != 2 {
+				fmt.Println("Usage: verify <file>")
+				continue
+			}
+			if err := farkle.VerifyLog(tokens[1]); err != nil {
+				fmt.Println(ColorRed+"Verification failed:", err, ColorReset)
+			}
+
 		default:
-			fmt.Println("Unknown command. Use 'play' or 'exit'.")
+			fmt.Println("Unknown command. Use 'play', 'lobbies', 'rules', 'solve', 'replay', 'verify', 'profile', 'stats' or 'exit'.")
 		}
 	}
 }
@@ -65,7 +131,21 @@ func handlePlay(args []string) {
 	isMP := false
 	create := false
 	joinID := ""
-	hostIP := "127.0.0.1"
+	pair := false // join without an ID: pair with a lobby on the local network
+	watch := false
+	hostIP := "" // joining: overrides the lobby ID's address (host or host:port); creating: the address to advertise
+	var dice farkle.DiceSource
+	rules := farkle.ClassicRules
+	opening := 0
+	penalty := 0
+	finalRound := false
+	aiSpec := ""
+	var names []string
+	resume := ""
+	logPath := ""
+	forfeit := false
+	fair := false
+	lan := false
 
 	for _, tok := range args {
 		switch {
@@ -78,8 +158,71 @@ func handlePlay(args []string) {
 			case strings.HasPrefix(tok, "--join="):
 				isMP = true
 				joinID = strings.ToUpper(strings.TrimPrefix(tok, "--join="))
+			case strings.HasPrefix(tok, "--watch="):
+				isMP, watch = true, true
+				joinID = strings.ToUpper(strings.TrimPrefix(tok, "--watch="))
+			case tok == "--join":
+				isMP, pair = true, true
+			case tok == "--watch":
+				isMP, watch, pair = true, true, true
 			case strings.HasPrefix(tok, "--host="):
 				hostIP = strings.TrimPrefix(tok, "--host=")
+			case strings.HasPrefix(tok, "--seed="):
+				seed, err := strconv.ParseUint(strings.TrimPrefix(tok, "--seed="), 10, 64)
+				if err != nil {
+					fmt.Println("Invalid seed:", tok)
+					return
+				}
+				dice = farkle.NewSeededDice(seed)
+			case strings.HasPrefix(tok, "--rules="):
+				r, err := farkle.LoadRules(strings.TrimPrefix(tok, "--rules="))
+				if err != nil {
+					fmt.Println("Invalid rules:", err)
+					return
+				}
+				rules = r
+			case tok == "--opening":
+				opening = 500
+			case strings.HasPrefix(tok, "--opening="):
+				v, err := strconv.Atoi(strings.TrimPrefix(tok, "--opening="))
+				if err != nil || v < 0 {
+					fmt.Println("Invalid opening score:", tok)
+					return
+				}
+				opening = v
+			case tok == "--penalty":
+				penalty = 1000
+			case strings.HasPrefix(tok, "--penalty="):
+				v, err := strconv.Atoi(strings.TrimPrefix(tok, "--penalty="))
+				if err != nil || v < 0 {
+					fmt.Println("Invalid farkle penalty:", tok)
+					return
+				}
+				penalty = v
+			case tok == "--final":
+				finalRound = true
+			case strings.HasPrefix(tok, "--ai="):
+				aiSpec = strings.ToLower(strings.TrimPrefix(tok, "--ai="))
+			case strings.HasPrefix(tok, "--players="):
+				names = strings.Split(strings.TrimPrefix(tok, "--players="), ",")
+			case strings.HasPrefix(tok, "--resume="):
+				resume = strings.TrimPrefix(tok, "--resume=")
+			case strings.HasPrefix(tok, "--log="):
+				logPath = strings.TrimPrefix(tok, "--log=")
+			case tok == "--fair":
+				fair = true
+			case tok == "--lan":
+				lan = true
+			case strings.HasPrefix(tok, "--on-drop="):
+				switch strings.TrimPrefix(tok, "--on-drop=") {
+				case "ai":
+					forfeit = false
+				case "forfeit":
+					forfeit = true
+				default:
+					fmt.Println("Invalid --on-drop (use ai or forfeit):", tok)
+					return
+				}
 			default:
 				fmt.Println("Unknown flag:", tok)
 				return
@@ -101,25 +244,336 @@ func handlePlay(args []string) {
 	}
 
 	// --- Dispatch ---
+	if resume != "" && isMP {
+		fmt.Println("Only solo games can be resumed.")
+		return
+	}
+	if fair && !create {
+		fmt.Println("--fair only applies when hosting (--mp --create).")
+		return
+	}
+	if lan && !create {
+		fmt.Println("--lan only applies when hosting (--mp --create).")
+		return
+	}
+	var gameLog *farkle.GameLog
+	if logPath != "" {
+		l, err := farkle.CreateLog(logPath)
+		if err != nil {
+			fmt.Println("Cannot create log:", err)
+			return
+		}
+		defer l.Close()
+		gameLog = l
+	}
+	name := ""
+	var stats *farkle.StatsTracker
+	if profile != nil {
+		name = profile.Name
+		switch {
+		case watch:
+			// Spectating does not count towards the profile.
+		case !isMP:
+			stats = profile.Track("", "", -1)
+		case joinID != "" || pair:
+			stats = profile.Track("online", "", 1)
+		default:
+			stats = profile.Track("online", "", 0)
+		}
+	}
+	var recs []farkle.Recorder
+	if gameLog != nil {
+		recs = append(recs, gameLog)
+	}
+	if stats != nil {
+		recs = append(recs, stats)
+	}
+	rec := farkle.Recorders(recs...)
+
+	if resume != "" {
+		if err := farkle.ResumeGame(resume, rec); err != nil {
+			fmt.Println("Cannot resume:", err)
+		}
+		return
+	}
+	opts := farkle.Options{Target: target, Rules: rules, Dice: dice, OpeningScore: opening, FarklePenalty: penalty, FinalRound: finalRound, Recorder: rec}
 	if !isMP {
-		farkle.WinningScore = target
-		farkle.PlayGame()
+		if len(names) == 0 {
+			if name == "" {
+				name = "You"
+			}
+			names = []string{name}
+		}
+		players, err := localSeats(names, aiSpec)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		farkle.PlayGame(opts, players...)
 		return
 	}
 
 	// Multiplayer validation
-	if create && joinID != "" {
-		fmt.Println("Cannot combine --create with --join.")
+	if create && (joinID != "" || pair) {
+		fmt.Println("Cannot combine --create with --join or --watch.")
+		return
+	}
+	if pair && hostIP == "" {
+		fmt.Println("--join or --watch without an ID needs --host=<addr> of a lobby on the local network; 'lobbies' finds them.")
 		return
 	}
 	if create {
-		farkle.HostLobby(target)
+		if fair && opts.Dice != nil {
+			fmt.Println("Cannot combine --fair with --seed.")
+			return
+		}
+		if opts.Dice == nil {
+			opts.Dice = farkle.CryptoDice{}
+		}
+		farkle.HostLobby(opts, farkle.HostOptions{Name: name, Forfeit: forfeit, Log: gameLog, Fair: fair, Address: hostIP, LAN: lan})
+		return
+	}
+	if joinID != "" || pair {
+		farkle.JoinLobby(hostIP, joinID, farkle.JoinOptions{Name: name, Watch: watch, Log: gameLog, Stats: stats})
+		return
+	}
+
+	fmt.Println("For multiplayer, use --create, --join=<ID> or --watch=<ID>  [--host=<ip>].")
+}
+
+// maxSeats caps the players of a local game.
+const maxSeats = 8
+
+// localSeats builds the players of a local game from the human names and
+// an --ai spec: a comma list of levels and/or seat counts ("hard", "2",
+// "hard,easy", "2,hard"). Without a spec a lone human gets one default AI.
+func localSeats(names []string, aiSpec string) ([]farkle.Player, error) {
+	var players []farkle.Player
+	seen := map[string]bool{}
+	for _, n := range names {
+		n = strings.TrimSpace(n)
+		if n == "" || len(n) > 20 {
+			return nil, fmt.Errorf("invalid player name %q", n)
+		}
+		if seen[strings.ToLower(n)] {
+			return nil, fmt.Errorf("duplicate player name %q", n)
+		}
+		seen[strings.ToLower(n)] = true
+		players = append(players, farkle.Player{Name: n})
+	}
+
+	var levels []string
+	if aiSpec == "" && len(players) == 1 {
+		aiSpec = farkle.DefaultStrategy
+	}
+	for _, item := range strings.Split(aiSpec, ",") {
+		if item == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(item); err == nil {
+			if n < 0 || n > maxSeats {
+				return nil, fmt.Errorf("invalid AI seat count %d", n)
+			}
+			for range n {
+				levels = append(levels, farkle.DefaultStrategy)
+			}
+			continue
+		}
+		levels = append(levels, item)
+	}
+	for i, level := range levels {
+		ai, err := farkle.NewStrategy(level)
+		if err != nil {
+			return nil, err
+		}
+		name := "Enemy"
+		if len(levels) > 1 {
+			name = fmt.Sprintf("CPU %d", i+1)
+		}
+		if seen[strings.ToLower(name)] {
+			return nil, fmt.Errorf("player name %q is taken by an AI seat", name)
+		}
+		players = append(players, farkle.Player{Name: name, Bot: ai})
+	}
+
+	if len(players) < 2 || len(players) > maxSeats {
+		return nil, fmt.Errorf("a local game needs 2–%d players (got %d)", maxSeats, len(players))
+	}
+	return players, nil
+}
+
+// handleProfile shows the active profile, or creates and switches to one.
+func handleProfile(args []string) {
+	if len(args) == 0 {
+		if profile == nil {
+			fmt.Println("No profile selected; use 'profile <name>' to create one.")
+		} else {
+			fmt.Println("Playing as " + profile.Name + ".")
+		}
+		if names, err := farkle.ListProfiles(); err == nil && len(names) > 0 {
+			fmt.Println("Profiles:", strings.Join(names, ", "))
+		}
+		return
+	}
+	if len(args) > 1 {
+		fmt.Println("Usage: profile <name> (one word)")
+		return
+	}
+	p, err := farkle.LoadProfile(args[0])
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if err := p.Save(); err != nil {
+		fmt.Println("Cannot save profile:", err)
+		return
+	}
+	if err := farkle.SetCurrentProfile(p.Name); err != nil {
+		fmt.Println("Cannot remember profile:", err)
+	}
+	profile = p
+	fmt.Println(ColorGreen + "Playing as " + p.Name + "." + ColorReset)
+}
+
+// handleStats prints the lifetime statistics of a profile.
+func handleStats(args []string) {
+	p := profile
+	if len(args) > 0 {
+		var err error
+		if p, err = farkle.LoadProfile(args[0]); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if p == nil {
+		fmt.Println("No profile selected; use 'profile <name>' first.")
+		return
+	}
+	p.PrintStats()
+}
+
+// handleLobbies lists the lobbies listed on the local network and pairs
+// with the one picked by number, for the host to admit; full lobbies are
+// joined as a spectator. Watching a game under way takes the lobby ID.
+// Any flags (e.g. --log=) are passed on to the join.
+func handleLobbies(args []string) {
+	fmt.Println(ColorBlue + "Looking for lobbies on the local network…" + ColorReset)
+	found, err := farkle.FindLobbies(2 * time.Second)
+	if err != nil {
+		fmt.Println(ColorRed+"Cannot search the local network:", err, ColorReset)
+		return
+	}
+	if len(found) == 0 {
+		fmt.Println("No lobbies found. Ask the host to create one with --lan, or for its lobby ID.")
+		return
+	}
+	for i, lb := range found {
+		state := fmt.Sprintf("%d/%d seats open", lb.Open, lb.Seats)
+		if lb.Started {
+			state = "in progress"
+		}
+		fmt.Printf("  %d. %-20s %s  first to %-6d %-14s %s\n", i+1, lb.Name, lb.Fingerprint, lb.Target, lb.Rules, state)
+	}
+	fmt.Print("Join which lobby? (number, or Enter to cancel) ")
+	line, ok := farkle.ReadLine()
+	if !ok || strings.TrimSpace(line) == "" {
 		return
 	}
-	if joinID != "" {
-		farkle.JoinLobby(hostIP, joinID)
+	n, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || n < 1 || n > len(found) {
+		fmt.Println("No such lobby.")
 		return
 	}
+	lb := found[n-1]
+	addr := net.JoinHostPort(lb.Addr, strconv.Itoa(lb.Port))
+	switch {
+	case lb.Started:
+		fmt.Printf("That game is under way; watching it takes the lobby ID (ask %s; it must match fingerprint %s): ", lb.Name, lb.Fingerprint)
+		line, ok = farkle.ReadLine()
+		id := strings.TrimSpace(line)
+		if !ok || id == "" {
+			return
+		}
+		if err := lb.Check(id); err != nil {
+			fmt.Println(ColorRed+"Cannot join:", err, ColorReset)
+			return
+		}
+		handlePlay(append([]string{"--mp", "--watch=" + id, "--host=" + addr}, args...))
+	case lb.Open == 0:
+		fmt.Println(ColorYellow + "That lobby is full; joining as a spectator." + ColorReset)
+		handlePlay(append([]string{"--mp", "--watch", "--host=" + addr}, args...))
+	default:
+		handlePlay(append([]string{"--mp", "--join", "--host=" + addr}, args...))
+	}
+}
 
-	fmt.Println("For multiplayer, use --create OR --join=<ID>  [--host=<ip>].")
+// handleRules prints a rule set, or lists the presets when none is given.
+func handleRules(args []string) {
+	if len(args) == 0 {
+		fmt.Println("Presets:", strings.Join(farkle.PresetNames(), ", "))
+		fmt.Println("Use 'rules <preset|file>' to see the scoring table.")
+		return
+	}
+	r, err := farkle.LoadRules(args[0])
+	if err != nil {
+		fmt.Println("Invalid rules:", err)
+		return
+	}
+	fmt.Println(ColorCyan + "Rules: " + r.Name + ColorReset)
+	for _, line := range r.Describe() {
+		fmt.Println("  " + line)
+	}
+}
+
+// handleSolve computes the optimal policies for a rule set and target and
+// saves the win-probability table.
+func handleSolve(args []string) {
+	target := 1000
+	rules := farkle.ClassicRules
+	out := ""
+	for _, tok := range args {
+		switch {
+		case strings.HasPrefix(tok, "--rules="):
+			r, err := farkle.LoadRules(strings.TrimPrefix(tok, "--rules="))
+			if err != nil {
+				fmt.Println("Invalid rules:", err)
+				return
+			}
+			rules = r
+		case strings.HasPrefix(tok, "--out="):
+			out = strings.TrimPrefix(tok, "--out=")
+		default:
+			v, err := strconv.Atoi(tok)
+			if err != nil || v < 1000 || v > 20000 {
+				fmt.Println("Invalid score:", tok)
+				return
+			}
+			target = v
+		}
+	}
+	if out == "" {
+		out = fmt.Sprintf("farkle-%s-%d.policy", rules.Name, target)
+	}
+
+	ev := solver.SolveEV(rules.KeepScore, 50, 20000)
+	fmt.Printf(ColorCyan+"Expected turn score (%s): %.0f"+ColorReset+"\n", rules.Name, ev.TurnValue())
+	for n := 6; n >= 1; n-- {
+		bankAt := 0
+		for t := 50; t < ev.Cap; t += 50 {
+			if !ev.ShouldRoll(solver.State{Turn: t, Dice: n}) {
+				bankAt = t
+				break
+			}
+		}
+		fmt.Printf("  %d dice left → bank at %d+\n", n, bankAt)
+	}
+
+	fmt.Println("Solving win probabilities to", target, "…")
+	win := solver.SolveWin(rules.KeepScore, target, 0)
+	win.Rules = rules.Name
+	if err := solver.SaveFile(out, win); err != nil {
+		fmt.Println(ColorRed+"Save failed:", err, ColorReset)
+		return
+	}
+	fmt.Printf(ColorGreen+"First player wins %.1f%% with optimal play. Saved %s."+ColorReset+"\n", 100*win.StartChance(0, 0), out)
 }